@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/Aligator77/go_practice/internal/config"
+	"github.com/Aligator77/go_practice/internal/handlers"
+	"github.com/Aligator77/go_practice/internal/stores"
+)
+
+// newProbes register checks of /livez and /readyz, checks of disabled stores are not added
+func newProbes(cfg config.Conf, db *config.ConnectionPool, store *stores.URLStore) *handlers.Probes {
+	probes := handlers.NewProbes(cfg.AppVersion, cfg.Health.Timeout)
+	probes.AddLive("background_deletes", handlers.Background(store.OldestDelete, cfg.Health.BackgroundAge))
+	if cfg.DisableDBStore == "0" {
+		probes.AddReady("db", db.Ping)
+	}
+	if len(cfg.LocalStore) > 0 {
+		probes.AddReady("file_store", handlers.FileWritable(cfg.LocalStore))
+		probes.AddReady("disk_space", handlers.DiskSpace(cfg.LocalStore, cfg.Health.MinDiskFree))
+	}
+	return probes
+}
@@ -2,25 +2,39 @@
 package main
 
 import (
-	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
-	"net/http/pprof"
+	"net/url"
 	"os"
-	"os/signal"
 	"strconv"
-	"syscall"
+	"strings"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	"github.com/Aligator77/go_practice/internal/auth"
+	"github.com/Aligator77/go_practice/internal/certs"
 	"github.com/Aligator77/go_practice/internal/config"
 	"github.com/Aligator77/go_practice/internal/controllers"
-	"github.com/Aligator77/go_practice/internal/handlers"
+	"github.com/Aligator77/go_practice/internal/diagnostics"
+	"github.com/Aligator77/go_practice/internal/grpcserver"
+	"github.com/Aligator77/go_practice/internal/helpers"
+	"github.com/Aligator77/go_practice/internal/lifecycle"
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/metrics"
 	"github.com/Aligator77/go_practice/internal/middlewares"
+	"github.com/Aligator77/go_practice/internal/models"
 	"github.com/Aligator77/go_practice/internal/stores"
+	"github.com/Aligator77/go_practice/internal/tracing"
 )
 
 const (
@@ -56,93 +70,293 @@ func main() {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 
-	errc := make(chan error, 1)
-	doneCh := make(chan struct{})
-	sigc := make(chan os.Signal, 1)
-
+	// variables of process are remembered before .env is loaded, so reload keeps their priority
+	processEnv := environmentKeys()
 	if err := godotenv.Load(); err != nil {
 		logger.Warn().Msg("error loading .env file")
 	}
 
-	cfg, err := config.New()
+	configLoader := config.NewLoader()
+	cfg, err := configLoader.Load()
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to load config")
 	}
+	if cfg.PrintConfig {
+		data, _ := json.MarshalIndent(cfg.Redacted(), "", "  ")
+		fmt.Println(string(data))
+		os.Exit(exitCodeSuccess)
+	}
+	setLogLevel(cfg.Log.Level)
+	// logs outside of requests, for example in background deletes, are written by main logger
+	zerolog.DefaultContextLogger = &logger
+	accessOut := io.Writer(os.Stdout)
+	if len(cfg.Log.AccessFile) > 0 {
+		accessFile, err := logging.OpenFile(cfg.Log.AccessFile)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to open access log file")
+		}
+		accessOut = accessFile
+	}
+	accessLevel, _ := zerolog.ParseLevel(cfg.Log.AccessLevel)
+	accessLogger := zerolog.New(accessOut).Level(accessLevel).With().Timestamp().Logger()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		OTLPInsecure: cfg.Tracing.OTLPInsecure,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+		ServiceName:  "shortener",
+		Version:      cfg.AppVersion,
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to setup tracing")
+	}
 
 	db, err := config.NewDBConn(&cfg)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create db connection")
 	}
+	canonical := helpers.CanonicalOptions{
+		SortQuery:     cfg.Canonical.SortQuery,
+		StripTracking: cfg.Canonical.StripTracking,
+	}
 	dbController := controllers.NewDBController(ctx, db)
-	_, err = dbController.Migrate(ctx)
+	_, err = dbController.Migrate(ctx, canonical)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to migrate db")
 	}
 	urlServices := stores.NewURLService(db, logger, cfg.BaseURL, cfg.LocalStore, cfg.DisableDBStore)
+	urlServices.Canonical = canonical
+	urlServices.Quota = models.Quota{
+		MaxLiveLinks:  cfg.Quota.MaxLiveLinks,
+		MaxDailyLinks: cfg.Quota.MaxDailyLinks,
+	}
+	destPolicy, err := newPolicy(cfg, cfg.BaseURL)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to load destination policy")
+	}
+	urlServices.SetPolicy(destPolicy)
+	metrics.RegisterStore(db.DB(), cfg.LocalStore, map[string]func() int64{
+		"deletes": urlServices.PendingDeletes,
+	})
+	probes := newProbes(cfg, db, urlServices)
 	urlController := controllers.NewURLController(urlServices)
+	urlController.BatchMaxItems = cfg.Batch.MaxItems
+	urlController.BatchMaxBodySize = cfg.Batch.MaxBodySize
+	authKeys, err := auth.ParseKeys(cfg.Auth.Secrets)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to parse auth secrets")
+	}
+	if len(authKeys) == 0 {
+		logger.Warn().Msg("AUTH_SECRETS is empty, user cookies will be invalid after restart")
+		authKeys = append(authKeys, auth.RandomKey())
+	}
+	urlController.Signer, err = auth.NewSigner(authKeys, cfg.Auth.TokenTTL)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to create cookie signer")
+	}
+	urlController.CookieSecure = cfg.Auth.CookieSecure || strings.HasPrefix(cfg.BaseURL, "https://")
+	admins, err := auth.ParseKeys(cfg.Admin.Tokens)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to parse admin tokens")
+	}
+	if len(admins) == 0 {
+		logger.Warn().Msg("ADMIN_TOKENS is empty, admin api is closed")
+	}
+	adminController := controllers.NewAdminController(urlServices)
 
-	r := chi.NewRouter()
-
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.NoCache)
-	r.Use(middleware.Compress(gzip.DefaultCompression, "text/html", "application/json"))
-	r.Use(middlewares.GzipAndLogger)
-
-	r.Route("/", func(r chi.Router) {
-		r.Get("/{id}", urlController.GetHandler)
-		r.Post("/", urlController.CreatePostHandler)
-		r.Post("/api/shorten", urlController.CreateRestHandler)
-		r.Post("/api/shorten/batch", urlController.CreateBatchHandler)
-		r.Get("/api/user/urls", urlController.CreateFullRestHandler) // add for iter15
-		r.Delete("/api/user/urls", urlController.CreateFullRestHandler)
-		r.Post("/api/user/urls", urlController.CreateFullRestHandler)
-		r.Get("/ping", dbController.CheckConnectHandler)
-
-		// Регистрация pprof-обработчиков
-		r.HandleFunc("/debug/pprof/", pprof.Index)
-		r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-		r.HandleFunc("/debug/pprof/profile", pprof.Profile)
-		r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-		r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// limiters are disabled, not removed, when rate limit is off, so reload can turn them on
+	routeLimiters := newLimiters(cfg)
+	routeLimiters.run(ctx)
+	proxies, err := middlewares.NewTrustedProxies(cfg.TrustedSubnet)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to parse trusted subnets")
+	}
+	r := newRouter(routes{
+		url:          urlController,
+		admin:        adminController,
+		db:           dbController,
+		probes:       probes,
+		admins:       admins,
+		limiters:     routeLimiters,
+		proxies:      proxies,
+		version:      cfg.AppVersion,
+		logger:       logger,
+		accessLogger: accessLogger,
+		accessSample: cfg.Log.AccessSample,
 	})
-	r.Get("/health", handlers.HealthCheck)
 	server := &http.Server{
 		Addr:    cfg.Server.Address,
 		Handler: r,
 	}
-	go func() {
-		err = server.ListenAndServe()
-	}()
-	logger.Info().Msg("go service Started")
-
-	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	certFile, keyFile := cfg.HTTPS.CertFile, cfg.HTTPS.KeyFile
+	if cfg.HTTPS.Enabled {
+		server.TLSConfig, err = certs.TLSConfig(cfg.HTTPS.MinVersion, cfg.HTTPS.Ciphers)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to create tls config")
+		}
+		if len(certFile) == 0 || len(keyFile) == 0 {
+			certFile, keyFile, err = certs.SelfSigned(cfg.HTTPS.CacheDir, tlsHosts(cfg))
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to create self-signed certificate")
+			}
+			logger.Warn().Str("cert", certFile).Msg("TLS_CERT_FILE or TLS_KEY_FILE is empty, self-signed certificate is used")
+		}
+	}
+	// listen before start, so busy port stops startup with error
+	listener, err := net.Listen("tcp", cfg.Server.Address)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to listen http address")
+	}
+	rl := &reloader{
+		logger:     logger,
+		loader:     configLoader,
+		started:    cfg,
+		current:    cfg,
+		store:      urlServices,
+		limiters:   routeLimiters,
+		proxies:    proxies,
+		processEnv: processEnv,
+	}
+	lc := lifecycle.New(logger, cfg.Shutdown.Timeout)
+	lc.Go("http", func() error {
+		var err error
+		if cfg.HTTPS.Enabled {
+			err = server.ServeTLS(listener, certFile, keyFile)
+		} else {
+			err = server.Serve(listener)
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	})
 
-	defer func() {
-		signal.Stop(sigc)
-		cancel()
-	}()
+	// grpc server uses the same certificate as http server
+	var grpcServer *grpc.Server
+	if len(cfg.GRPC.Address) > 0 {
+		var grpcOpts []grpc.ServerOption
+		if cfg.HTTPS.Enabled {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to load tls certificate for grpc")
+			}
+			grpcTLS := server.TLSConfig.Clone()
+			grpcTLS.Certificates = []tls.Certificate{cert}
+			grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(grpcTLS)))
+		}
+		grpcServer = grpcserver.New(urlController, grpcserver.Limits{
+			Create:   routeLimiters.create,
+			Batch:    routeLimiters.batch,
+			Redirect: routeLimiters.redirect,
+			Proxies:  proxies,
+		}, grpcOpts...)
+		grpcListener, err := net.Listen("tcp", cfg.GRPC.Address)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to listen grpc address")
+		}
+		lc.Go("grpc", func() error {
+			return grpcServer.Serve(grpcListener)
+		})
+		logger.Info().Str("address", cfg.GRPC.Address).Msg("grpc service Started")
+	}
 
-	go func() {
-		select {
-		case sig := <-sigc:
-			logger.Info().Str("signal", sig.String()).Msg("received signal, exiting")
+	// pprof, metrics and config are served only by debug server, it is not reachable from public address
+	var debugServer *http.Server
+	if len(cfg.Debug.Address) > 0 {
+		debugListener, err := listenDebug(cfg.Debug.Address)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to listen debug address")
+		}
+		debugServer = &http.Server{
+			Handler: diagnostics.Handler(diagnostics.Options{
+				User:     cfg.Debug.User,
+				Password: cfg.Debug.Password,
+				Token:    cfg.Debug.Token,
+				Version:  cfg.AppVersion,
+				Config: func() any {
+					return rl.Current().Redacted()
+				},
+			}),
+		}
+		lc.Go("debug", func() error {
+			err := debugServer.Serve(debugListener)
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		})
+		logger.Info().Str("address", cfg.Debug.Address).Msg("debug service Started")
+	}
+	logger.Info().Str("address", listener.Addr().String()).Msg("go service Started")
 
-			err := server.Shutdown(ctx)
-			if err != nil {
-				return
-			} // Close http connection
-			_ = urlServices.Shutdown()
-			signal.Stop(sigc)
-			close(doneCh)
-		case <-errc:
-			logger.Info().Str("error code", strconv.Itoa(exitCodeFailure)).Msg("now exiting with error")
-			os.Exit(exitCodeFailure)
+	// readiness fails first, so load balancer stops sending requests, then servers stop intake,
+	// background work is finished and stores are closed
+	lc.OnShutdown("readiness", func(ctx context.Context) error {
+		return probes.Drain(ctx, cfg.Shutdown.DrainDelay)
+	})
+	lc.OnShutdown("servers", func(ctx context.Context) error {
+		g, ctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			return server.Shutdown(ctx)
+		})
+		if grpcServer != nil {
+			g.Go(func() error {
+				return stopGRPC(ctx, grpcServer)
+			})
 		}
-	}()
+		if debugServer != nil {
+			g.Go(func() error {
+				return debugServer.Shutdown(ctx)
+			})
+		}
+		return g.Wait()
+	})
+	lc.OnShutdown("background deletes", urlServices.WaitBackground)
+	lc.OnShutdown("file store", func(context.Context) error {
+		return urlServices.Flush()
+	})
+	lc.OnShutdown("db", func(context.Context) error {
+		return urlServices.Shutdown()
+	})
+	// spans of shutdown steps are sent too
+	lc.OnShutdown("traces", shutdownTracing)
 
-	<-doneCh
+	lc.OnReload(rl.reload)
+
+	err = lc.Wait()
+	cancel()
+	if err != nil {
+		logger.Error().Err(err).Str("error code", strconv.Itoa(exitCodeFailure)).Msg("now exiting with error")
+		os.Exit(exitCodeFailure)
+	}
 	logger.Info().Msg("goodbye")
 }
+
+// tlsHosts return names for self-signed certificate
+func tlsHosts(cfg config.Conf) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host, _, err := net.SplitHostPort(cfg.Server.Address); err == nil && len(host) > 0 {
+		hosts = append(hosts, host)
+	}
+	if u, err := url.Parse(cfg.BaseURL); err == nil && len(u.Hostname()) > 0 {
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
+}
+
+// stopGRPC wait for running calls until ctx is done, then close connections
+func stopGRPC(ctx context.Context, s *grpc.Server) error {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+
+	"github.com/Aligator77/go_practice/internal/config"
+	"github.com/Aligator77/go_practice/internal/middlewares"
+	"github.com/Aligator77/go_practice/internal/policy"
+	"github.com/Aligator77/go_practice/internal/stores"
+)
+
+// reloadableKeys are settings applied by SIGHUP, other changed settings need restart
+var reloadableKeys = map[string]bool{
+	"LOG_LEVEL":                 true,
+	"RATE_LIMIT_ENABLED":        true,
+	"RATE_LIMIT_CREATE_RATE":    true,
+	"RATE_LIMIT_CREATE_BURST":   true,
+	"RATE_LIMIT_BATCH_RATE":     true,
+	"RATE_LIMIT_BATCH_BURST":    true,
+	"RATE_LIMIT_REDIRECT_RATE":  true,
+	"RATE_LIMIT_REDIRECT_BURST": true,
+	"POLICY_SCHEMES":            true,
+	"POLICY_DOMAIN_LIST_FILE":   true,
+	"POLICY_DOMAIN_LIST_MODE":   true,
+	"POLICY_ALLOW_PRIVATE":      true,
+	"POLICY_RESOLVE_HOSTS":      true,
+	"POLICY_SHORTENERS":         true,
+	"TRUSTED_SUBNET":            true,
+}
+
+// limiters are rate limiters of routes, they are created even when rate limit is disabled,
+// so it can be enabled by reload
+type limiters struct {
+	create, batch, redirect *middlewares.Limiter
+}
+
+func newLimiters(cfg config.Conf) limiters {
+	l := limiters{
+		create:   middlewares.NewLimiter(middlewares.RateLimit{}, cfg.RateLimit.IdleTTL, cfg.RateLimit.MaxBuckets),
+		batch:    middlewares.NewLimiter(middlewares.RateLimit{}, cfg.RateLimit.IdleTTL, cfg.RateLimit.MaxBuckets),
+		redirect: middlewares.NewLimiter(middlewares.RateLimit{}, cfg.RateLimit.IdleTTL, cfg.RateLimit.MaxBuckets),
+	}
+	l.update(cfg)
+	return l
+}
+
+func (l limiters) update(cfg config.Conf) {
+	l.create.Update(middlewares.RateLimit{Rate: cfg.RateLimit.CreateRate, Burst: cfg.RateLimit.CreateBurst}, cfg.RateLimit.Enabled)
+	l.batch.Update(middlewares.RateLimit{Rate: cfg.RateLimit.BatchRate, Burst: cfg.RateLimit.BatchBurst}, cfg.RateLimit.Enabled)
+	l.redirect.Update(middlewares.RateLimit{Rate: cfg.RateLimit.RedirectRate, Burst: cfg.RateLimit.RedirectBurst}, cfg.RateLimit.Enabled)
+}
+
+// run start eviction of idle buckets, it stops with ctx
+func (l limiters) run(ctx context.Context) {
+	go l.create.Run(ctx)
+	go l.batch.Run(ctx)
+	go l.redirect.Run(ctx)
+}
+
+// newPolicy create destination policy from config, domain list file is read again.
+// BASE_URL is restart-only, so baseURL is base url of start, short links are made with it
+func newPolicy(cfg config.Conf, baseURL string) (*policy.Policy, error) {
+	shorteners := cfg.Policy.Shorteners
+	if len(shorteners) == 0 {
+		shorteners = policy.DefaultShorteners
+	}
+	return policy.New(policy.Config{
+		Schemes:        cfg.Policy.Schemes,
+		DomainListFile: cfg.Policy.DomainListFile,
+		DomainListMode: cfg.Policy.DomainListMode,
+		AllowPrivate:   cfg.Policy.AllowPrivate,
+		ResolveHosts:   cfg.Policy.ResolveHosts,
+		BaseURL:        baseURL,
+		Shorteners:     shorteners,
+	})
+}
+
+// setLogLevel apply LOG_LEVEL to all loggers, level is checked by config validation
+func setLogLevel(level string) {
+	if l, err := zerolog.ParseLevel(level); err == nil {
+		zerolog.SetGlobalLevel(l)
+	}
+}
+
+// reloader read config again on SIGHUP and apply settings, which can be changed at runtime.
+// Invalid config is not applied at all, current settings are kept
+type reloader struct {
+	logger   zerolog.Logger
+	loader   *config.Loader
+	started  config.Conf // config of start, changed restart-only settings are compared with it
+	current  config.Conf // it is read by debug server, so it is changed under mu
+	mu       sync.RWMutex
+	store    *stores.URLStore
+	limiters limiters
+	proxies  *middlewares.TrustedProxies
+	// processEnv are variables of process environment, .env file does not override them
+	processEnv map[string]bool
+}
+
+func (rl *reloader) reload() {
+	rl.reloadDotEnv()
+	cfg, err := rl.loader.Load()
+	if err != nil {
+		rl.logger.Error().Err(err).Msg("config is not reloaded, current settings are kept")
+		return
+	}
+	p, err := newPolicy(cfg, rl.started.BaseURL)
+	if err != nil {
+		rl.logger.Error().Err(err).Msg("config is not reloaded, failed to load destination policy")
+		return
+	}
+
+	setLogLevel(cfg.Log.Level)
+	rl.limiters.update(cfg)
+	rl.store.SetPolicy(p)
+	// subnets are checked by config validation, so update does not fail here
+	_ = rl.proxies.Update(cfg.TrustedSubnet)
+
+	var applied, ignored []string
+	for _, key := range rl.current.Changed(cfg) {
+		if reloadableKeys[key] {
+			applied = append(applied, key)
+		}
+	}
+	for _, key := range rl.started.Changed(cfg) {
+		if !reloadableKeys[key] {
+			ignored = append(ignored, key)
+		}
+	}
+	rl.mu.Lock()
+	rl.current = cfg
+	rl.mu.Unlock()
+	if len(ignored) > 0 {
+		// values are not logged, some of them are secrets
+		rl.logger.Warn().Strs("ignored", ignored).Msg("changed settings need restart")
+	}
+	rl.logger.Info().Strs("changed", applied).Msg("config reloaded")
+}
+
+// Current return config with last applied reload
+func (rl *reloader) Current() config.Conf {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.current
+}
+
+// reloadDotEnv read .env file again, variables of process environment keep priority
+// the same as on start
+func (rl *reloader) reloadDotEnv() {
+	values, err := godotenv.Read()
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			rl.logger.Warn().Err(err).Msg("error loading .env file")
+		}
+		values = map[string]string{}
+	}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := values[key]; !ok && !rl.processEnv[key] {
+			_ = os.Unsetenv(key)
+		}
+	}
+	for key, value := range values {
+		if !rl.processEnv[key] {
+			_ = os.Setenv(key, value)
+		}
+	}
+}
+
+// environmentKeys return names of variables set in process environment
+func environmentKeys() map[string]bool {
+	keys := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		keys[key] = true
+	}
+	return keys
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"compress/gzip"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+
+	"github.com/Aligator77/go_practice/internal/auth"
+	"github.com/Aligator77/go_practice/internal/controllers"
+	"github.com/Aligator77/go_practice/internal/handlers"
+	"github.com/Aligator77/go_practice/internal/middlewares"
+	"github.com/Aligator77/go_practice/internal/openapi"
+)
+
+// routes are dependencies of public router
+type routes struct {
+	url      *controllers.URLController
+	admin    *controllers.AdminController
+	db       *controllers.DBController
+	probes   *handlers.Probes
+	admins   []auth.Key
+	limiters limiters
+	proxies  *middlewares.TrustedProxies
+	version  string
+
+	logger       zerolog.Logger
+	accessLogger zerolog.Logger
+	accessSample uint32
+}
+
+// newRouter create public router, every route must be described in openapi document,
+// TestOpenAPIRoutes check it
+func newRouter(rt routes) chi.Router {
+	createLimit := middlewares.RateLimiter(rt.limiters.create, rt.url.RateLimitKey)
+	batchLimit := middlewares.RateLimiter(rt.limiters.batch, rt.url.RateLimitKey)
+	redirectLimit := middlewares.RateLimiter(rt.limiters.redirect, rt.url.RateLimitKey)
+
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequestID)
+	r.Use(rt.proxies.RealIP)
+	r.Use(middlewares.Tracing)
+	r.Use(middlewares.AccessLog(rt.logger, rt.accessLogger, rt.accessSample))
+	r.Use(middlewares.Metrics)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.Compress(gzip.DefaultCompression, "text/html", "application/json"))
+	r.Use(middlewares.Gunzip)
+
+	r.Route("/", func(r chi.Router) {
+		r.Use(middleware.NoCache)
+		r.With(redirectLimit).Get("/{id}", rt.url.GetHandler)
+		r.With(createLimit).Post("/", rt.url.CreatePostHandler)
+		r.With(createLimit).Post("/api/shorten", rt.url.CreateRestHandler)
+		r.With(batchLimit).Post("/api/shorten/batch", rt.url.CreateBatchHandler)
+		r.Get("/api/user/urls", rt.url.CreateFullRestHandler) // add for iter15
+		r.Delete("/api/user/urls", rt.url.CreateFullRestHandler)
+		r.With(createLimit).Post("/api/user/urls", rt.url.CreateFullRestHandler)
+		r.Patch("/api/user/urls/{id}", rt.url.UpdateHandler)
+		r.With(batchLimit).Post("/api/user/urls/import", rt.url.ImportHandler)
+		r.Get("/api/user/urls/export", rt.url.ExportHandler)
+		r.Post("/api/user/keys", rt.url.CreateAPIKeyHandler)
+		r.Get("/api/user/keys", rt.url.ListAPIKeysHandler)
+		r.Delete("/api/user/keys/{id}", rt.url.RevokeAPIKeyHandler)
+		r.Get("/api/user/quota", rt.url.QuotaHandler)
+		r.Get("/ping", rt.db.CheckConnectHandler)
+
+		r.Route("/api/admin", func(r chi.Router) {
+			r.Use(middlewares.AdminAuth(rt.admins, rt.admin.DeniedAudit))
+			r.Get("/urls", rt.admin.SearchURLsHandler)
+			r.Post("/urls/{id}/disable", rt.admin.DisableURLHandler)
+			r.Post("/urls/{id}/restore", rt.admin.RestoreURLHandler)
+			r.Get("/users/{userID}/urls", rt.admin.UserURLsHandler)
+			r.Post("/users/{userID}/block", rt.admin.BlockUserHandler)
+			r.Delete("/users/{userID}/block", rt.admin.UnblockUserHandler)
+			r.Put("/users/{userID}/quota", rt.admin.SetQuotaHandler)
+			r.Get("/audit", rt.admin.AuditHandler)
+		})
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.NoCache)
+		r.Get("/health", handlers.HealthCheck(rt.version))
+		r.Get("/livez", rt.probes.LiveHandler)
+		r.Get("/readyz", rt.probes.ReadyHandler)
+	})
+	r.Get("/openapi.json", openapi.Handler(rt.version))
+	r.Get("/docs", openapi.Docs)
+	// qr codes live outside NoCache group, they send own caching headers
+	r.With(redirectLimit).Get("/{id}/qr", rt.url.QRHandler)
+	return r
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Aligator77/go_practice/internal/openapi"
+)
+
+// TestOpenAPIRoutes fail when route of public router is not described in openapi document
+// or document describes route, which is not registered
+func TestOpenAPIRoutes(t *testing.T) {
+	r := newRouter(routes{version: "1.2.3"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var spec openapi.Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, openapi.Version, spec.OpenAPI)
+	assert.Equal(t, "1.2.3", spec.Info.Version, "Версия документа должна быть версией сервиса")
+
+	registered := map[string]bool{}
+	err := chi.Walk(r, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// routes of chi.Route("/") sub router are walked with "/*/" prefix
+		route = strings.ReplaceAll(route, "/*/", "/")
+		key := strings.ToLower(method) + " " + route
+		registered[key] = true
+		_, ok := spec.Paths[route][strings.ToLower(method)]
+		assert.True(t, ok, "Маршрут %s %s не описан в openapi.json", method, route)
+		return nil
+	})
+	require.NoError(t, err)
+
+	for path, operations := range spec.Paths {
+		for method, op := range operations {
+			assert.True(t, registered[method+" "+path], "В openapi.json описан незарегистрированный маршрут %s %s", method, path)
+			assert.NotEmpty(t, op.Responses, "%s %s", method, path)
+		}
+	}
+	for _, route := range []string{"post /", "get /{id}", "post /api/shorten", "post /api/shorten/batch", "get /api/user/urls", "get /ping", "get /health"} {
+		assert.True(t, registered[route], "Маршрут %s должен быть зарегистрирован", route)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "openapi.json", "Страница документации должна читать openapi.json")
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// APIKeyPrefix mark api keys, so they can be found by secret scanners
+	APIKeyPrefix = "sk_"
+	// apiKeyVisibleLen is length of key part shown in list of keys
+	apiKeyVisibleLen = len(APIKeyPrefix) + 8
+)
+
+var ErrScope = errors.New("api key has no scope for this action")
+
+// GenerateAPIKey return new key and its prefix, which can be shown to user later
+func GenerateAPIKey() (key string, prefix string) {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:apiKeyVisibleLen]
+}
+
+// HashAPIKey return hash stored instead of key. Keys are random 256 bit values,
+// so fast hash is enough, slow password hashes are needed only for weak secrets
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// BearerToken return token from Authorization header, ok is false when header has other scheme
+func BearerToken(r *http.Request) (token string, ok bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey(t *testing.T) {
+	key, prefix := GenerateAPIKey()
+	other, _ := GenerateAPIKey()
+	assert.True(t, strings.HasPrefix(key, APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(key, prefix))
+	assert.NotEqual(t, key, other, "Ключи должны быть случайными")
+	assert.Equal(t, HashAPIKey(key), HashAPIKey(key))
+	assert.NotEqual(t, HashAPIKey(key), HashAPIKey(other))
+	assert.NotContains(t, HashAPIKey(key), key)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, ok := BearerToken(r)
+	assert.False(t, ok)
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, ok = BearerToken(r)
+	assert.False(t, ok, "Другие схемы авторизации не являются ключами")
+	r.Header.Set("Authorization", "bearer "+key)
+	token, ok := BearerToken(r)
+	assert.True(t, ok)
+	assert.Equal(t, key, token)
+}
@@ -0,0 +1,152 @@
+// Package auth sign and verify user identity tokens
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSecretLen protect from short secrets, which can be brute forced
+const minSecretLen = 16
+
+var (
+	ErrNoToken      = errors.New("token is missing")
+	ErrInvalidToken = errors.New("token signature is invalid")
+	ErrExpiredToken = errors.New("token is expired")
+	ErrNoKeys       = errors.New("at least one signing key is required")
+)
+
+// Key is HMAC secret with id, id is written to token, so old keys can verify tokens after rotation
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKeys parse keys in "id:secret" form, the first key signs new tokens
+func ParseKeys(specs []string) ([]Key, error) {
+	keys := make([]Key, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+		id, secret, ok := strings.Cut(spec, ":")
+		if !ok || len(id) == 0 || strings.Contains(id, ".") {
+			return nil, errors.New("auth key must be in id:secret form, id can not contain dots")
+		}
+		if len(secret) < minSecretLen {
+			return nil, errors.New("auth secret of key " + id + " is shorter than " + strconv.Itoa(minSecretLen))
+		}
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+// RandomKey generate key for one process run, tokens become invalid after restart
+func RandomKey() Key {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+	return Key{ID: hex.EncodeToString(id), Secret: secret}
+}
+
+// Signer create tokens in "key id.user id.expiration.signature" form
+type Signer struct {
+	active Key
+	keys   map[string]Key
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewSigner(keys []Key, ttl time.Duration) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	s := &Signer{
+		active: keys[0],
+		keys:   make(map[string]Key, len(keys)),
+		ttl:    ttl,
+		now:    time.Now,
+	}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+	}
+	return s, nil
+}
+
+// TTL return lifetime of signed tokens
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+func (s *Signer) Sign(userID string) string {
+	expire := strconv.FormatInt(s.now().Add(s.ttl).Unix(), 10)
+	payload := s.active.ID + "." + base64.RawURLEncoding.EncodeToString([]byte(userID)) + "." + expire
+	return payload + "." + sign(s.active, payload)
+}
+
+// Verify check token signature and expiration, rotate is true when token is signed by old key
+// and should be replaced by token of active key
+func (s *Signer) Verify(token string) (userID string, rotate bool, err error) {
+	userID, key, _, err := s.verify(token)
+	if err != nil {
+		return "", false, err
+	}
+	return userID, key.ID != s.active.ID, nil
+}
+
+// Issued check token the same as Verify and return time it was signed,
+// it is counted back from expiration by current TTL
+func (s *Signer) Issued(token string) (userID string, issued time.Time, err error) {
+	userID, _, expire, err := s.verify(token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return userID, time.Unix(expire, 0).Add(-s.ttl), nil
+}
+
+func (s *Signer) verify(token string) (userID string, key Key, expire int64, err error) {
+	if len(token) == 0 {
+		return "", key, 0, ErrNoToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return "", key, 0, ErrInvalidToken
+	}
+	key, ok := s.keys[parts[0]]
+	if !ok {
+		return "", key, 0, ErrInvalidToken
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(sign(key, payload)), []byte(parts[3])) {
+		return "", key, 0, ErrInvalidToken
+	}
+
+	expire, err = strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", key, 0, ErrInvalidToken
+	}
+	if s.now().Unix() > expire {
+		return "", key, 0, ErrExpiredToken
+	}
+	user, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(user) == 0 {
+		return "", key, 0, ErrInvalidToken
+	}
+
+	return string(user), key, expire, nil
+}
+
+func sign(key Key, payload string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
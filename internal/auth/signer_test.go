@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	oldKey := Key{ID: "old", Secret: []byte("old-secret-0123456789")}
+	newKey := Key{ID: "new", Secret: []byte("new-secret-0123456789")}
+
+	oldSigner, err := NewSigner([]Key{oldKey}, time.Hour)
+	assert.NoError(t, err, "Ошибка создания подписи")
+	signer, err := NewSigner([]Key{newKey, oldKey}, time.Hour)
+	assert.NoError(t, err, "Ошибка создания подписи")
+
+	t.Run("valid", func(t *testing.T) {
+		userID, rotate, err := signer.Verify(signer.Sign("user-1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", userID)
+		assert.False(t, rotate)
+	})
+
+	t.Run("issued", func(t *testing.T) {
+		userID, issued, err := signer.Issued(signer.Sign("user-1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", userID)
+		assert.WithinDuration(t, time.Now(), issued, 2*time.Second, "Время подписи считается от срока действия")
+	})
+
+	t.Run("rotated key", func(t *testing.T) {
+		userID, rotate, err := signer.Verify(oldSigner.Sign("user-1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "user-1", userID)
+		assert.True(t, rotate, "Токен старого ключа должен быть переподписан")
+	})
+
+	t.Run("forged user", func(t *testing.T) {
+		parts := strings.Split(signer.Sign("user-1"), ".")
+		parts[1] = strings.Split(signer.Sign("user-2"), ".")[1]
+		_, _, err := signer.Verify(strings.Join(parts, "."))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, _, err := oldSigner.Verify(signer.Sign("user-1"))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("bare uuid", func(t *testing.T) {
+		_, _, err := signer.Verify("0190f0c4-5d5e-7c1a-9a4e-1f2b3c4d5e6f")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token := signer.Sign("user-1")
+		signer.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		defer func() { signer.now = time.Now }()
+		_, _, err := signer.Verify(token)
+		assert.ErrorIs(t, err, ErrExpiredToken)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, _, err := signer.Verify("")
+		assert.ErrorIs(t, err, ErrNoToken)
+	})
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys([]string{"k2:second-secret-value", " k1:first-secret-value "})
+	assert.NoError(t, err)
+	assert.Equal(t, []Key{
+		{ID: "k2", Secret: []byte("second-secret-value")},
+		{ID: "k1", Secret: []byte("first-secret-value")},
+	}, keys)
+
+	_, err = ParseKeys([]string{"short:secret"})
+	assert.Error(t, err, "Короткий секрет должен быть отклонен")
+	_, err = ParseKeys([]string{"no-separator"})
+	assert.Error(t, err)
+	_, err = ParseKeys([]string{"a.b:long-enough-secret"})
+	assert.Error(t, err)
+
+	_, err = NewSigner(nil, time.Hour)
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
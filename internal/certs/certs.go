@@ -0,0 +1,164 @@
+// Package certs prepare tls configuration and self-signed certificates for https server
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	certFileName = "cert.pem"
+	keyFileName  = "key.pem"
+
+	selfSignedTTL = 365 * 24 * time.Hour
+	// renewBefore replace cached certificate, which expires soon
+	renewBefore = 24 * time.Hour
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// http2Ciphers are required by HTTP/2 for TLS 1.2, see RFC 7540 section 9.2.2
+var http2Ciphers = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+}
+
+// TLSConfig create server config with HTTP/2 support. Versions older than 1.2 are not accepted,
+// ciphers are names from crypto/tls, only secure ones are allowed. Empty ciphers keep Go defaults
+func TLSConfig(minVersion string, ciphers []string) (*tls.Config, error) {
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("tls min version must be 1.2 or 1.3, got %q", minVersion)
+	}
+	cfg := &tls.Config{
+		MinVersion: version,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if len(ciphers) == 0 {
+		return cfg, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	for _, name := range ciphers {
+		name = strings.TrimSpace(name)
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure tls cipher %q", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+	// cipher suites are not configurable in TLS 1.3, so only TLS 1.2 needs HTTP/2 ciphers
+	if version == tls.VersionTLS12 && !containsAny(cfg.CipherSuites, http2Ciphers) {
+		return nil, errors.New("tls ciphers must contain TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 for HTTP/2")
+	}
+	return cfg, nil
+}
+
+// SelfSigned return paths of certificate and key cached in dir, new pair is generated
+// when dir has no valid certificate. It is only for development, browsers do not trust it
+func SelfSigned(dir string, hosts []string) (certFile string, keyFile string, err error) {
+	certFile = filepath.Join(dir, certFileName)
+	keyFile = filepath.Join(dir, keyFileName)
+	if cachedValid(certFile, keyFile) {
+		return certFile, keyFile, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	certPEM, keyPEM, err := generate(hosts)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+func cachedValid(certFile string, keyFile string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil || len(pair.Certificate) == 0 {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+	return time.Now().Add(renewBefore).Before(cert.NotAfter)
+}
+
+func generate(hosts []string) (certPEM []byte, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"go_practice development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedTTL),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if len(host) > 0 {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func containsAny(ids []uint16, wanted []uint16) bool {
+	for _, id := range ids {
+		for _, w := range wanted {
+			if id == w {
+				return true
+			}
+		}
+	}
+	return false
+}
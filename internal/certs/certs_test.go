@@ -0,0 +1,54 @@
+package certs
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSConfig(t *testing.T) {
+	cfg, err := TLSConfig("1.2", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.Contains(t, cfg.NextProtos, "h2", "HTTP/2 должен быть включен")
+
+	cfg, err = TLSConfig("1.2", []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, cfg.CipherSuites)
+
+	_, err = TLSConfig("1.0", nil)
+	assert.Error(t, err, "Устаревшая версия TLS должна быть отклонена")
+	_, err = TLSConfig("1.2", []string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err, "Небезопасный шифр должен быть отклонен")
+	_, err = TLSConfig("1.2", []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+	assert.Error(t, err, "Без шифров HTTP/2 конфигурация невалидна")
+	_, err = TLSConfig("1.3", []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+	assert.NoError(t, err)
+}
+
+func TestSelfSigned(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	certFile, keyFile, err := SelfSigned(dir, []string{"localhost", "127.0.0.1"})
+	assert.NoError(t, err)
+	_, err = tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err, "Сертификат и ключ не подходят друг другу")
+
+	info, err := os.Stat(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Ключ должен быть доступен только владельцу")
+
+	first, _ := os.ReadFile(certFile)
+	_, _, err = SelfSigned(dir, []string{"localhost"})
+	assert.NoError(t, err)
+	second, _ := os.ReadFile(certFile)
+	assert.Equal(t, first, second, "Сертификат должен браться из кеша")
+
+	assert.NoError(t, os.WriteFile(certFile, []byte("broken"), 0644))
+	_, _, err = SelfSigned(dir, []string{"localhost"})
+	assert.NoError(t, err)
+	third, _ := os.ReadFile(certFile)
+	assert.NotEqual(t, first, third, "Сломанный сертификат должен быть создан заново")
+}
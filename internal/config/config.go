@@ -3,10 +3,13 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
-
-	"github.com/Aligator77/go_practice/internal/helpers"
 )
 
 type Conf struct {
@@ -29,38 +32,198 @@ type Conf struct {
 		MaxIdleCon int    `env:"DB_MAX_IDLE_CON" envDefault:"30"`
 		DSN        string `env:"DATABASE_DSN"`
 	}
+	Batch struct {
+		MaxItems    int   `env:"BATCH_MAX_ITEMS" envDefault:"1000"`
+		MaxBodySize int64 `env:"BATCH_MAX_BODY_SIZE" envDefault:"1048576"`
+	}
+	Canonical struct {
+		SortQuery     bool `env:"CANONICAL_SORT_QUERY" envDefault:"true"`
+		StripTracking bool `env:"CANONICAL_STRIP_TRACKING" envDefault:"false"`
+	}
+	Policy struct {
+		Schemes        []string `env:"POLICY_SCHEMES" envDefault:"http,https" envSeparator:","`
+		DomainListFile string   `env:"POLICY_DOMAIN_LIST_FILE"`
+		DomainListMode string   `env:"POLICY_DOMAIN_LIST_MODE" envDefault:"block"`
+		AllowPrivate   bool     `env:"POLICY_ALLOW_PRIVATE" envDefault:"false"`
+		ResolveHosts   bool     `env:"POLICY_RESOLVE_HOSTS" envDefault:"true"`
+		Shorteners     []string `env:"POLICY_SHORTENERS" envSeparator:","` // known shorteners are used when empty
+	}
+	Auth struct {
+		Secrets      []string      `env:"AUTH_SECRETS" envSeparator:","` // id:secret pairs, the first one signs cookies
+		CookieSecure bool          `env:"AUTH_COOKIE_SECURE" envDefault:"false"`
+		TokenTTL     time.Duration `env:"AUTH_TOKEN_TTL" envDefault:"8760h"`
+	}
+	RateLimit struct {
+		Enabled       bool          `env:"RATE_LIMIT_ENABLED" envDefault:"true"`
+		CreateRate    float64       `env:"RATE_LIMIT_CREATE_RATE" envDefault:"20"` // requests per second
+		CreateBurst   int           `env:"RATE_LIMIT_CREATE_BURST" envDefault:"100"`
+		BatchRate     float64       `env:"RATE_LIMIT_BATCH_RATE" envDefault:"2"`
+		BatchBurst    int           `env:"RATE_LIMIT_BATCH_BURST" envDefault:"10"`
+		RedirectRate  float64       `env:"RATE_LIMIT_REDIRECT_RATE" envDefault:"100"`
+		RedirectBurst int           `env:"RATE_LIMIT_REDIRECT_BURST" envDefault:"200"`
+		IdleTTL       time.Duration `env:"RATE_LIMIT_IDLE_TTL" envDefault:"10m"`
+		MaxBuckets    int           `env:"RATE_LIMIT_MAX_BUCKETS" envDefault:"100000"`
+	}
+	// TrustedSubnet are subnets of proxies in CIDR form, X-Real-IP and X-Forwarded-For are accepted only from them
+	TrustedSubnet []string `env:"TRUSTED_SUBNET" envSeparator:","`
+
+	Quota struct {
+		MaxLiveLinks  int `env:"QUOTA_MAX_LIVE_LINKS" envDefault:"0"` // 0 means no limit
+		MaxDailyLinks int `env:"QUOTA_MAX_DAILY_LINKS" envDefault:"0"`
+	}
+	Admin struct {
+		Tokens []string `env:"ADMIN_TOKENS" envSeparator:","` // name:token pairs, admin api is closed when empty
+	}
+	Log struct {
+		Level        string `env:"LOG_LEVEL" envDefault:"info"` // trace, debug, info, warn, error
+		AccessLevel  string `env:"LOG_ACCESS_LEVEL" envDefault:"info"`
+		AccessSample uint32 `env:"LOG_ACCESS_SAMPLE" envDefault:"1"` // every n-th successful request is logged
+		AccessFile   string `env:"LOG_ACCESS_FILE"`                  // stdout is used when empty
+	}
+	Tracing struct {
+		Exporter     string  `env:"TRACING_EXPORTER" envDefault:"off"` // off, stdout or otlp
+		OTLPEndpoint string  `env:"OTLP_ENDPOINT" envDefault:"localhost:4317"`
+		OTLPInsecure bool    `env:"OTLP_INSECURE" envDefault:"true"`
+		SampleRatio  float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"` // part of new traces, from 0 to 1
+	}
+	Shutdown struct {
+		Timeout    time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`    // deadline of all shutdown steps
+		DrainDelay time.Duration `env:"SHUTDOWN_DRAIN_DELAY" envDefault:"0s"` // /readyz fails this long before servers stop
+	}
+	Health struct {
+		Timeout       time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s"`
+		MinDiskFree   uint64        `env:"HEALTH_MIN_DISK_FREE" envDefault:"104857600"` // bytes on disk of file store
+		BackgroundAge time.Duration `env:"HEALTH_BACKGROUND_MAX_AGE" envDefault:"5m"`   // background delete running longer is stuck
+	}
+	Debug struct {
+		Address  string `env:"DEBUG_ADDRESS"` // host:port or unix:/path, debug server is disabled when empty
+		User     string `env:"DEBUG_USER"`    // basic auth of debug server
+		Password string `env:"DEBUG_PASSWORD"`
+		Token    string `env:"DEBUG_TOKEN"` // bearer token of debug server
+	}
+	GRPC struct {
+		Address string `env:"GRPC_ADDRESS"` // grpc server is disabled when empty
+	}
+	HTTPS struct {
+		Enabled    bool     `env:"ENABLE_HTTPS" envDefault:"false"`
+		CertFile   string   `env:"TLS_CERT_FILE"` // self-signed certificate is used when cert or key is empty
+		KeyFile    string   `env:"TLS_KEY_FILE"`
+		CacheDir   string   `env:"TLS_CACHE_DIR" envDefault:"/tmp/short-url-tls"`
+		MinVersion string   `env:"TLS_MIN_VERSION" envDefault:"1.2"`
+		Ciphers    []string `env:"TLS_CIPHERS" envSeparator:","` // go defaults are used when empty
+	}
+
+	PrintConfig bool // set by --print-config flag, it is not read from env
 }
 
+// Loader keep parsed command line flags, so config can be loaded again on reload
+type Loader struct {
+	serverAddr  *string
+	baseURL     *string
+	localStore  *string
+	dbDsn       *string
+	enableHTTPS *bool
+	trusted     *string
+	configFile  *string
+	printConfig *bool
+	// set are names of flags given in command line, only they override env and file
+	set map[string]bool
+}
+
+// NewLoader define and parse command line flags
+func NewLoader() *Loader {
+	l := &Loader{
+		serverAddr:  flag.String("a", "", "http server address, host:port"),
+		baseURL:     flag.String("b", "", "base url of short links, http(s)://host[:port]"),
+		localStore:  flag.String("f", "", "path of file store, empty value disables it"),
+		dbDsn:       flag.String("d", "", "postgres dsn, db store is used when it is set"),
+		enableHTTPS: flag.Bool("s", false, "enable https"),
+		trusted:     flag.String("t", "", "trusted subnets of proxies in CIDR form, comma separated"),
+		configFile:  flag.String("c", "", "path of json config file"),
+		printConfig: flag.Bool("print-config", false, "print effective config without secrets and exit"),
+		set:         make(map[string]bool),
+	}
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		l.set[f.Name] = true
+	})
+	return l
+}
+
+// New build config from flags, env variables, json config file and defaults, in order of priority.
+// Config file is set by -c flag or CONFIG env variable
 func New() (Conf, error) {
+	return NewLoader().Load()
+}
+
+// Load read env variables and config file again and apply flags over them
+func (l *Loader) Load() (Conf, error) {
 	serverConf := Conf{}
-	err := env.Parse(&serverConf)
-	if err != nil {
+
+	path := os.Getenv("CONFIG")
+	if l.set["c"] {
+		path = *l.configFile
+	}
+	environment := make(map[string]string)
+	if len(path) > 0 {
+		var err error
+		environment, err = fileEnvironment(path)
+		if err != nil {
+			return serverConf, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	for key, value := range env.ToMap(os.Environ()) {
+		environment[key] = value
+	}
+	if err := env.ParseWithOptions(&serverConf, env.Options{Environment: environment}); err != nil {
 		return serverConf, err
 	}
 
-	serverAddrFlag := flag.String("a", "", "input server address")
-	baseURLFlag := flag.String("b", "", "input server address")
-	localStoreFile := flag.String("f", "", "input server address")
-	dbDsn := flag.String("d", "", "input db dsn address")
-	flag.Parse()
-
-	if len(*serverAddrFlag) > 0 && helpers.CheckFlag(serverAddrFlag) {
-		serverConf.Server.Address = *serverAddrFlag
+	if l.set["a"] {
+		serverConf.Server.Address = *l.serverAddr
 	}
-
-	if len(*baseURLFlag) > 0 && helpers.CheckFlagHTTP(baseURLFlag) {
-		serverConf.BaseURL = *baseURLFlag
+	if l.set["b"] {
+		serverConf.BaseURL = *l.baseURL
 	}
-
-	if len(*localStoreFile) > 0 {
-		serverConf.LocalStore = *localStoreFile
+	if l.set["f"] {
+		serverConf.LocalStore = *l.localStore
+	}
+	if l.set["d"] {
+		serverConf.DB.DSN = *l.dbDsn
+	}
+	if l.set["s"] {
+		serverConf.HTTPS.Enabled = *l.enableHTTPS
 	}
-	if len(*dbDsn) > 0 {
-		serverConf.DB.DSN = *dbDsn
+	if l.set["t"] {
+		serverConf.TrustedSubnet = nil
+		for _, subnet := range strings.Split(*l.trusted, ",") {
+			if len(subnet) > 0 {
+				serverConf.TrustedSubnet = append(serverConf.TrustedSubnet, subnet)
+			}
+		}
+	}
+
+	// base url is switched to https only when it is not set explicitly
+	_, baseURLSet := environment["BASE_URL"]
+	if serverConf.HTTPS.Enabled && !baseURLSet && !l.set["b"] {
+		serverConf.BaseURL = httpsBaseURL(serverConf.Server.Address)
 	}
 	if len(serverConf.DB.DSN) > 0 {
 		serverConf.DisableDBStore = "0"
 	}
+	serverConf.PrintConfig = *l.printConfig
 
-	return serverConf, nil
+	return serverConf, serverConf.Validate()
+}
+
+// httpsBaseURL build base url from server address, address without host like ":8443" is served on localhost
+func httpsBaseURL(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "https://" + address
+	}
+	if len(host) == 0 {
+		host = "localhost"
+	}
+	return "https://" + net.JoinHostPort(host, port)
 }
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func TestFileEnvironment(t *testing.T) {
+	path := writeConfig(t, `{
+		"server_address": "localhost:9090",
+		"enable_https": true,
+		"batch_max_items": 10,
+		"rate_limit_create_rate": 2.5,
+		"shutdown_timeout": "5s",
+		"admin_tokens": ["alice:token1", "bob:token2"],
+		"tls_cert_file": null
+	}`)
+	environment, err := fileEnvironment(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"SERVER_ADDRESS":         "localhost:9090",
+		"ENABLE_HTTPS":           "true",
+		"BATCH_MAX_ITEMS":        "10",
+		"RATE_LIMIT_CREATE_RATE": "2.5",
+		"SHUTDOWN_TIMEOUT":       "5s",
+		"ADMIN_TOKENS":           "alice:token1,bob:token2",
+	}, environment)
+
+	// env variables override file, file overrides defaults
+	environment["BATCH_MAX_ITEMS"] = "20"
+	var conf Conf
+	require.NoError(t, env.ParseWithOptions(&conf, env.Options{Environment: environment}))
+	assert.Equal(t, "localhost:9090", conf.Server.Address)
+	assert.Equal(t, 20, conf.Batch.MaxItems)
+	assert.Equal(t, 5*time.Second, conf.Shutdown.Timeout)
+	assert.Equal(t, []string{"alice:token1", "bob:token2"}, conf.Admin.Tokens)
+	assert.Equal(t, "http://localhost:8080", conf.BaseURL, "Не заданное значение должно браться по умолчанию")
+
+	_, err = fileEnvironment(writeConfig(t, `{"server_adress": "localhost:9090"}`))
+	assert.ErrorContains(t, err, `unknown option "server_adress"`, "Опечатка в имени опции должна быть ошибкой")
+	_, err = fileEnvironment(writeConfig(t, `{"server_address": `))
+	assert.ErrorContains(t, err, "invalid json")
+}
+
+func TestValidate(t *testing.T) {
+	var conf Conf
+	require.NoError(t, env.ParseWithOptions(&conf, env.Options{Environment: map[string]string{}}))
+	assert.NoError(t, conf.Validate(), "Значения по умолчанию должны быть валидны")
+	assert.Empty(t, conf.GRPC.Address, "gRPC выключен по умолчанию")
+
+	conf.Server.Address = "localhost"
+	conf.BaseURL = "localhost:8080"
+	conf.DB.DSN = "postgres://user:secret@db:port/name"
+	conf.DB.MaxIdleCon = 100
+	conf.TrustedSubnet = []string{"10.0.0.0/8", "10.0.0.1"}
+	conf.Batch.MaxItems = MaxBatchItems + 1
+	err := conf.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SERVER_ADDRESS (-a): must be host:port")
+	assert.Contains(t, err.Error(), "BASE_URL (-b): scheme must be http or https")
+	assert.Contains(t, err.Error(), "DATABASE_DSN (-d): invalid postgres url")
+	assert.Contains(t, err.Error(), "DB_MAX_IDLE_CON: must not be greater than DB_MAX_OPEN_CON")
+	assert.Contains(t, err.Error(), `TRUSTED_SUBNET (-t): must be subnets in CIDR form, got "10.0.0.1"`)
+	assert.NotContains(t, err.Error(), "10.0.0.0/8")
+	assert.Contains(t, err.Error(), "BATCH_MAX_ITEMS: must be from 1 to 10922, got 10923", "Батч не должен превышать лимит параметров postgres")
+	assert.NotContains(t, err.Error(), "secret", "Пароль не должен попадать в ошибку")
+}
+
+func TestHTTPSBaseURL(t *testing.T) {
+	assert.Equal(t, "https://localhost:8443", httpsBaseURL(":8443"), "Адрес без хоста должен указывать на localhost")
+	assert.Equal(t, "https://example.com:443", httpsBaseURL("example.com:443"))
+	assert.Equal(t, "https://[::1]:8443", httpsBaseURL("[::1]:8443"))
+}
+
+func TestValidateDebug(t *testing.T) {
+	var conf Conf
+	require.NoError(t, env.ParseWithOptions(&conf, env.Options{Environment: map[string]string{}}))
+	assert.Empty(t, conf.Debug.Address, "Отладка выключена по умолчанию")
+	for _, address := range []string{"localhost:6060", "127.0.0.1:6060", "[::1]:6060", "unix:/tmp/debug.sock", ""} {
+		conf.Debug.Address = address
+		assert.NoError(t, conf.Validate(), address)
+	}
+
+	conf.Debug.Address = ":6060"
+	err := conf.Validate()
+	require.Error(t, err, "Отладка на всех интерфейсах без авторизации запрещена")
+	assert.Contains(t, err.Error(), "DEBUG_ADDRESS")
+	conf.Debug.Token = "token"
+	assert.NoError(t, conf.Validate())
+
+	conf.Debug.User = "ops"
+	err = conf.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "DEBUG_USER and DEBUG_PASSWORD")
+}
+
+func TestRedacted(t *testing.T) {
+	var conf Conf
+	require.NoError(t, env.ParseWithOptions(&conf, env.Options{Environment: map[string]string{
+		"DATABASE_DSN": "postgres://user:secret@db:5432/name?sslmode=disable",
+		"AUTH_SECRETS": "k1:0123456789abcdef",
+		"DB_PASSWORD":  "secret",
+		"DEBUG_TOKEN":  "token",
+	}}))
+	res := conf.Redacted()
+	assert.Equal(t, "postgres://user:xxxxx@db:5432/name?sslmode=disable", res["database_dsn"])
+	assert.Equal(t, []string{"k1:xxxxx"}, res["auth_secrets"])
+	assert.Equal(t, "xxxxx", res["db_password"])
+	assert.Equal(t, "xxxxx", res["debug_token"])
+	assert.Equal(t, "", res["debug_password"])
+	assert.Equal(t, []string{}, res["admin_tokens"])
+	assert.Equal(t, "30s", res["shutdown_timeout"])
+	assert.Equal(t, "localhost:8080", res["server_address"])
+}
+
+func TestChanged(t *testing.T) {
+	var old, conf Conf
+	require.NoError(t, env.ParseWithOptions(&old, env.Options{Environment: map[string]string{}}))
+	require.NoError(t, env.ParseWithOptions(&conf, env.Options{Environment: map[string]string{
+		"LOG_LEVEL":      "debug",
+		"DB_PASSWORD":    "other",
+		"POLICY_SCHEMES": "https",
+	}}))
+	assert.ElementsMatch(t, []string{"LOG_LEVEL", "DB_PASSWORD", "POLICY_SCHEMES"}, old.Changed(conf), "Изменения секретов тоже должны находиться")
+	assert.Empty(t, conf.Changed(conf))
+}
@@ -85,6 +85,14 @@ func (cp *ConnectionPool) Close() error {
 	return nil
 }
 
+// Ping check connection to db, it does nothing when db store is disabled
+func (cp *ConnectionPool) Ping(ctx context.Context) error {
+	if cp.DisableDBStore == "0" {
+		return cp.db.PingContext(ctx)
+	}
+	return nil
+}
+
 func (cp *ConnectionPool) CheckConnection(ctx context.Context) bool {
 	if cp.DisableDBStore == "0" {
 		err := cp.db.PingContext(ctx)
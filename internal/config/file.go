@@ -0,0 +1,173 @@
+// Package config this part of config package read json config file and print effective config
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// redacted is the same as password placeholder of url.URL.Redacted
+const redacted = "xxxxx"
+
+// redactedKeys are secrets hidden by Redacted, keys with id:secret pairs keep ids
+var redactedKeys = map[string]bool{
+	"DB_PASSWORD":    true,
+	"DATABASE_DSN":   true,
+	"AUTH_SECRETS":   true,
+	"ADMIN_TOKENS":   true,
+	"DEBUG_PASSWORD": true,
+	"DEBUG_TOKEN":    true,
+}
+
+// fileEnvironment read json config file and return its values by names of env variables.
+// Keys of file are names of env variables in lower case: {"server_address": "localhost:8080"},
+// lists are json arrays, durations are strings like "30s"
+func fileEnvironment(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+
+	known, err := envKeys()
+	if err != nil {
+		return nil, err
+	}
+	environment := make(map[string]string, len(values))
+	for key, value := range values {
+		name := strings.ToUpper(key)
+		if !known[name] {
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+		switch v := value.(type) {
+		case nil:
+			continue
+		case string:
+			environment[name] = v
+		case json.Number:
+			environment[name] = v.String()
+		case bool:
+			environment[name] = fmt.Sprint(v)
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("option %q must be list of strings", key)
+				}
+				items = append(items, s)
+			}
+			environment[name] = strings.Join(items, ",")
+		default:
+			return nil, fmt.Errorf("option %q has unsupported value", key)
+		}
+	}
+	return environment, nil
+}
+
+func envKeys() (map[string]bool, error) {
+	params, err := env.GetFieldParams(&Conf{})
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(params))
+	for _, p := range params {
+		keys[p.Key] = true
+	}
+	return keys, nil
+}
+
+// Redacted return config in format of config file with hidden secrets
+func (c Conf) Redacted() map[string]any {
+	res := make(map[string]any)
+	eachEnvField(reflect.ValueOf(c), func(key string, field reflect.Value) {
+		var value any
+		switch v := field.Interface().(type) {
+		case time.Duration:
+			value = v.String()
+		case []string:
+			if v == nil {
+				v = []string{}
+			}
+			value = v
+		default:
+			value = v
+		}
+		if redactedKeys[key] {
+			value = redact(key, value)
+		}
+		res[strings.ToLower(key)] = value
+	})
+	return res
+}
+
+// Changed return names of env variables, which values differ in other config
+func (c Conf) Changed(other Conf) []string {
+	values := make(map[string]any)
+	eachEnvField(reflect.ValueOf(other), func(key string, field reflect.Value) {
+		values[key] = field.Interface()
+	})
+	var changed []string
+	eachEnvField(reflect.ValueOf(c), func(key string, field reflect.Value) {
+		if !reflect.DeepEqual(field.Interface(), values[key]) {
+			changed = append(changed, key)
+		}
+	})
+	return changed
+}
+
+func redact(key string, value any) any {
+	switch v := value.(type) {
+	case []string:
+		// ids of keys are needed to check rotation, only secrets are hidden
+		hidden := make([]string, 0, len(v))
+		for _, pair := range v {
+			id, _, _ := strings.Cut(pair, ":")
+			hidden = append(hidden, id+":"+redacted)
+		}
+		return hidden
+	case string:
+		if len(v) == 0 {
+			return v
+		}
+		if key == "DATABASE_DSN" {
+			if u, err := url.Parse(v); err == nil && len(u.Host) > 0 {
+				if query := u.Query(); query.Has("password") {
+					query.Set("password", redacted)
+					u.RawQuery = query.Encode()
+				}
+				return u.Redacted()
+			}
+		}
+		return redacted
+	}
+	return value
+}
+
+// eachEnvField call fn for every field with env tag, nested structs are walked too
+func eachEnvField(v reflect.Value, fn func(key string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if key, _, _ := strings.Cut(t.Field(i).Tag.Get("env"), ","); len(key) > 0 {
+			fn(key, field)
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			eachEnvField(field, fn)
+		}
+	}
+}
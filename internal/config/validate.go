@@ -0,0 +1,167 @@
+// Package config this part of config package check values of config
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// MaxBatchItems is the largest BATCH_MAX_ITEMS, postgres accepts at most 65535 params in query
+// and batch insert binds 6 params per link
+const MaxBatchItems = 65535 / 6
+
+// Validate check all values and return one error with every problem found,
+// names in messages are names of env variables
+func (c Conf) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	if err := validateAddress(c.Server.Address); err != nil {
+		problems = append(problems, "SERVER_ADDRESS (-a): "+err.Error())
+	}
+	if len(c.GRPC.Address) > 0 {
+		if err := validateAddress(c.GRPC.Address); err != nil {
+			problems = append(problems, "GRPC_ADDRESS: "+err.Error())
+		}
+	}
+	if len(c.Debug.Address) > 0 {
+		if err := validateDebug(c.Debug.Address, len(c.Debug.Token) > 0 || len(c.Debug.User) > 0); err != nil {
+			problems = append(problems, "DEBUG_ADDRESS: "+err.Error())
+		}
+	}
+	check((len(c.Debug.User) == 0) == (len(c.Debug.Password) == 0), "DEBUG_USER and DEBUG_PASSWORD: must be set both or none")
+	if err := validateBaseURL(c.BaseURL); err != nil {
+		problems = append(problems, "BASE_URL (-b): "+err.Error())
+	}
+	check(c.DisableDBStore == "0" || c.DisableDBStore == "1", "DISABLE_DB_STORE: must be 0 or 1, got %q", c.DisableDBStore)
+	if len(c.DB.DSN) > 0 {
+		if err := validateDSN(c.DB.DSN); err != nil {
+			problems = append(problems, "DATABASE_DSN (-d): "+err.Error())
+		}
+	}
+	check(c.DB.MaxOpenCon >= 0, "DB_MAX_OPEN_CON: must not be negative, got %d", c.DB.MaxOpenCon)
+	check(c.DB.MaxIdleCon >= 0, "DB_MAX_IDLE_CON: must not be negative, got %d", c.DB.MaxIdleCon)
+	check(c.DB.MaxOpenCon == 0 || c.DB.MaxIdleCon <= c.DB.MaxOpenCon,
+		"DB_MAX_IDLE_CON: must not be greater than DB_MAX_OPEN_CON (%d), got %d", c.DB.MaxOpenCon, c.DB.MaxIdleCon)
+
+	check(c.Batch.MaxItems > 0 && c.Batch.MaxItems <= MaxBatchItems,
+		"BATCH_MAX_ITEMS: must be from 1 to %d, got %d", MaxBatchItems, c.Batch.MaxItems)
+	check(c.Batch.MaxBodySize > 0, "BATCH_MAX_BODY_SIZE: must be positive, got %d", c.Batch.MaxBodySize)
+	check(c.Policy.DomainListMode == "block" || c.Policy.DomainListMode == "allow",
+		"POLICY_DOMAIN_LIST_MODE: must be block or allow, got %q", c.Policy.DomainListMode)
+	check(c.Auth.TokenTTL > 0, "AUTH_TOKEN_TTL: must be positive, got %s", c.Auth.TokenTTL)
+
+	if c.RateLimit.Enabled {
+		check(c.RateLimit.CreateRate > 0 && c.RateLimit.CreateBurst > 0, "RATE_LIMIT_CREATE_RATE and RATE_LIMIT_CREATE_BURST: must be positive")
+		check(c.RateLimit.BatchRate > 0 && c.RateLimit.BatchBurst > 0, "RATE_LIMIT_BATCH_RATE and RATE_LIMIT_BATCH_BURST: must be positive")
+		check(c.RateLimit.RedirectRate > 0 && c.RateLimit.RedirectBurst > 0, "RATE_LIMIT_REDIRECT_RATE and RATE_LIMIT_REDIRECT_BURST: must be positive")
+	}
+	for _, subnet := range c.TrustedSubnet {
+		_, _, err := net.ParseCIDR(strings.TrimSpace(subnet))
+		check(err == nil, "TRUSTED_SUBNET (-t): must be subnets in CIDR form, got %q", subnet)
+	}
+	check(c.Quota.MaxLiveLinks >= 0, "QUOTA_MAX_LIVE_LINKS: must not be negative, got %d", c.Quota.MaxLiveLinks)
+	check(c.Quota.MaxDailyLinks >= 0, "QUOTA_MAX_DAILY_LINKS: must not be negative, got %d", c.Quota.MaxDailyLinks)
+	_, err := zerolog.ParseLevel(c.Log.Level)
+	check(err == nil && len(c.Log.Level) > 0, "LOG_LEVEL: must be one of trace, debug, info, warn, error, got %q", c.Log.Level)
+	_, err = zerolog.ParseLevel(c.Log.AccessLevel)
+	check(err == nil && len(c.Log.AccessLevel) > 0, "LOG_ACCESS_LEVEL: must be one of trace, debug, info, warn, error, got %q", c.Log.AccessLevel)
+	check(c.Log.AccessSample > 0, "LOG_ACCESS_SAMPLE: must be positive, got %d", c.Log.AccessSample)
+	check(c.Tracing.Exporter == "off" || c.Tracing.Exporter == "stdout" || c.Tracing.Exporter == "otlp",
+		"TRACING_EXPORTER: must be off, stdout or otlp, got %q", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO: must be from 0 to 1, got %v", c.Tracing.SampleRatio)
+	if c.Tracing.Exporter == "otlp" {
+		if err := validateAddress(c.Tracing.OTLPEndpoint); err != nil {
+			problems = append(problems, "OTLP_ENDPOINT: "+err.Error())
+		}
+	}
+	check(c.Shutdown.Timeout > 0, "SHUTDOWN_TIMEOUT: must be positive, got %s", c.Shutdown.Timeout)
+	check(c.Shutdown.DrainDelay >= 0 && c.Shutdown.DrainDelay < c.Shutdown.Timeout,
+		"SHUTDOWN_DRAIN_DELAY: must not be negative and must be less than SHUTDOWN_TIMEOUT (%s), got %s", c.Shutdown.Timeout, c.Shutdown.DrainDelay)
+	check(c.Health.Timeout > 0, "HEALTH_CHECK_TIMEOUT: must be positive, got %s", c.Health.Timeout)
+	check(c.Health.BackgroundAge > 0, "HEALTH_BACKGROUND_MAX_AGE: must be positive, got %s", c.Health.BackgroundAge)
+
+	if c.HTTPS.Enabled {
+		check(c.HTTPS.MinVersion == "1.2" || c.HTTPS.MinVersion == "1.3", "TLS_MIN_VERSION: must be 1.2 or 1.3, got %q", c.HTTPS.MinVersion)
+		check((len(c.HTTPS.CertFile) == 0) == (len(c.HTTPS.KeyFile) == 0), "TLS_CERT_FILE and TLS_KEY_FILE: must be set both or none")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateAddress check host:port, host can be empty to listen all interfaces
+func validateAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("must be host:port, got %q", address)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		return fmt.Errorf("port must be number from 0 to 65535, got %q", port)
+	}
+	return nil
+}
+
+// validateDebug check address of debug server, profiles and config must not be open to network,
+// so address which is not loopback or unix socket needs auth
+func validateDebug(address string, withAuth bool) error {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		if len(path) == 0 {
+			return errors.New("path of unix socket is empty")
+		}
+		return nil
+	}
+	if err := validateAddress(address); err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(address)
+	ip := net.ParseIP(host)
+	if !withAuth && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("%q is not loopback address, set DEBUG_TOKEN or DEBUG_USER and DEBUG_PASSWORD", address)
+	}
+	return nil
+}
+
+func validateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("must be url, got %q", baseURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", baseURL)
+	}
+	if len(u.Host) == 0 {
+		return fmt.Errorf("host is empty in %q", baseURL)
+	}
+	return nil
+}
+
+// validateDSN accept postgres url or key=value connection string, password is not shown in errors
+func validateDSN(dsn string) error {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if _, err := pq.ParseURL(dsn); err != nil {
+			return errors.New("invalid postgres url")
+		}
+		return nil
+	}
+	for _, pair := range strings.Fields(dsn) {
+		if key, _, ok := strings.Cut(pair, "="); !ok || len(key) == 0 {
+			return errors.New("must be postgres:// url or key=value pairs")
+		}
+	}
+	return nil
+}
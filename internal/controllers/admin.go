@@ -0,0 +1,310 @@
+// Package controllers contain server handlers and proxy requests to store
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/gofrs/uuid"
+
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/middlewares"
+	"github.com/Aligator77/go_practice/internal/models"
+	"github.com/Aligator77/go_practice/internal/server"
+	"github.com/Aligator77/go_practice/internal/stores"
+)
+
+// AdminController serve /api/admin routes, they must be wrapped by middlewares.AdminAuth
+type AdminController struct {
+	URLStore *stores.URLStore
+}
+
+func NewAdminController(URLService *stores.URLStore) *AdminController {
+	return &AdminController{
+		URLStore: URLService,
+	}
+}
+
+// SearchURLsHandler search links of all users, filters are the same as in user urls listing
+func (a *AdminController) SearchURLsHandler(w http.ResponseWriter, r *http.Request) {
+	a.listURLs(w, r, "")
+}
+
+// UserURLsHandler show links of one user
+func (a *AdminController) UserURLsHandler(w http.ResponseWriter, r *http.Request) {
+	a.listURLs(w, r, chi.URLParam(r, "userID"))
+}
+
+func (a *AdminController) listURLs(w http.ResponseWriter, r *http.Request, userID string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	action, target := models.AuditSearchURLs, ""
+	if len(userID) > 0 {
+		action, target = models.AuditViewUserURLs, userID
+	}
+	filter, err := parseURLListFilter(r.URL.Query())
+	if err != nil {
+		a.reject(w, r, action, target, r.URL.RawQuery, server.ErrInvalidRequest(err))
+		return
+	}
+
+	var redirects []models.Redirect
+	var next string
+	if len(userID) > 0 {
+		redirects, next, err = a.URLStore.GetRedirectsByUserPage(r.Context(), userID, filter)
+	} else {
+		redirects, next, err = a.URLStore.SearchRedirects(r.Context(), filter)
+	}
+	if errors.Is(err, stores.ErrInvalidCursor) {
+		a.reject(w, r, action, target, r.URL.RawQuery, server.ErrInvalidRequest(err))
+		return
+	}
+	if err != nil {
+		a.reject(w, r, action, target, r.URL.RawQuery, server.ErrStorage(err))
+		return
+	}
+	if !a.accept(w, r, action, target, r.URL.RawQuery, http.StatusOK) {
+		return
+	}
+
+	if len(next) > 0 {
+		nextQuery := r.URL.Query()
+		nextQuery.Set("cursor", next)
+		w.Header().Set("X-Next-Cursor", next)
+		w.Header().Set("Link", `<`+r.URL.Path+"?"+nextQuery.Encode()+`>; rel="next"`)
+	}
+	res := make([]models.AdminURLResponse, 0, len(redirects))
+	for _, redirect := range redirects {
+		res = append(res, a.urlResponse(redirect))
+	}
+	render.JSON(w, r, res)
+}
+
+// DisableURLHandler take down link of any user, it answers 410 from now on
+func (a *AdminController) DisableURLHandler(w http.ResponseWriter, r *http.Request) {
+	a.setURLDeleted(w, r, true)
+}
+
+// RestoreURLHandler bring back disabled link, unless its url is shortened again
+func (a *AdminController) RestoreURLHandler(w http.ResponseWriter, r *http.Request) {
+	a.setURLDeleted(w, r, false)
+}
+
+func (a *AdminController) setURLDeleted(w http.ResponseWriter, r *http.Request, deleted bool) {
+	w.Header().Set("Content-Type", "application/json")
+	id := chi.URLParam(r, "id")
+	action := models.AuditRestoreURL
+	if deleted {
+		action = models.AuditDisableURL
+	}
+	req, err := decodeAdminAction(r)
+	if err != nil {
+		a.reject(w, r, action, id, "", server.ErrInvalidRequest(err))
+		return
+	}
+
+	redirect, err := a.URLStore.GetRedirect(r.Context(), id)
+	if err != nil {
+		a.reject(w, r, action, id, req.Reason, server.ErrStorage(err))
+		return
+	}
+	if redirect.Redirect != id {
+		a.reject(w, r, action, id, req.Reason, server.ErrNotFound)
+		return
+	}
+	if !deleted {
+		existRedirect, _ := a.URLStore.GetRedirectByURL(r.Context(), redirect.URL)
+		if len(existRedirect.URL) > 0 && existRedirect.Redirect != id && existRedirect.IsDelete == 0 {
+			a.reject(w, r, action, id, req.Reason, server.ErrConflict("url is shortened again as "+a.URLStore.MakeFullURL(existRedirect.Redirect)))
+			return
+		}
+	}
+
+	redirect, err = a.URLStore.SetRedirectDeleted(r.Context(), id, deleted)
+	if errors.Is(err, stores.ErrRedirectNotFound) {
+		a.reject(w, r, action, id, req.Reason, server.ErrNotFound)
+		return
+	}
+	if err != nil {
+		a.reject(w, r, action, id, req.Reason, server.ErrStorage(err))
+		return
+	}
+
+	if !a.accept(w, r, action, id, req.Reason, http.StatusOK) {
+		return
+	}
+	render.JSON(w, r, a.urlResponse(redirect))
+}
+
+// BlockUserHandler forbid user to create new links
+func (a *AdminController) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	req, err := decodeAdminAction(r)
+	if err != nil {
+		a.reject(w, r, models.AuditBlockUser, userID, "", server.ErrInvalidRequest(err))
+		return
+	}
+
+	err = a.URLStore.BlockUser(r.Context(), models.BlockedUser{
+		UserID:     userID,
+		Admin:      middlewares.AdminFromContext(r.Context()),
+		Reason:     req.Reason,
+		DateCreate: time.Now().UTC(),
+	})
+	if err != nil {
+		a.reject(w, r, models.AuditBlockUser, userID, req.Reason, server.ErrStorage(err))
+		return
+	}
+	if !a.accept(w, r, models.AuditBlockUser, userID, req.Reason, http.StatusNoContent) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AdminController) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	req, err := decodeAdminAction(r)
+	if err != nil {
+		a.reject(w, r, models.AuditUnblockUser, userID, "", server.ErrInvalidRequest(err))
+		return
+	}
+
+	if err := a.URLStore.UnblockUser(r.Context(), userID); err != nil {
+		a.reject(w, r, models.AuditUnblockUser, userID, req.Reason, server.ErrStorage(err))
+		return
+	}
+	if !a.accept(w, r, models.AuditUnblockUser, userID, req.Reason, http.StatusNoContent) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetQuotaHandler override quota of one user, null fields fall back to global quota
+func (a *AdminController) SetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := chi.URLParam(r, "userID")
+
+	data := &models.QuotaOverride{}
+	if err := render.Bind(r, data); err != nil {
+		a.reject(w, r, models.AuditSetQuota, userID, "", server.ErrInvalidRequest(err))
+		return
+	}
+	detail, _ := json.Marshal(data)
+	if err := a.URLStore.SetUserQuota(r.Context(), userID, *data); err != nil {
+		a.reject(w, r, models.AuditSetQuota, userID, string(detail), server.ErrStorage(err))
+		return
+	}
+	quota, err := a.URLStore.GetUserQuota(r.Context(), userID)
+	if err != nil {
+		a.reject(w, r, models.AuditSetQuota, userID, string(detail), server.ErrStorage(err))
+		return
+	}
+	if !a.accept(w, r, models.AuditSetQuota, userID, string(detail), http.StatusOK) {
+		return
+	}
+	render.JSON(w, r, quota)
+}
+
+// AuditHandler show last admin actions
+func (a *AdminController) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	limit := models.AuditLogDefaultLimit
+	if l := r.URL.Query().Get("limit"); len(l) > 0 {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > models.AuditLogMaxLimit {
+			a.reject(w, r, models.AuditViewAuditLog, "", r.URL.RawQuery,
+				server.ErrInvalidRequest(fmt.Errorf("limit must be between 1 and %d", models.AuditLogMaxLimit)))
+			return
+		}
+	}
+
+	records, err := a.URLStore.GetAuditRecords(r.Context(), limit)
+	if err != nil {
+		a.reject(w, r, models.AuditViewAuditLog, "", r.URL.RawQuery, server.ErrStorage(err))
+		return
+	}
+	if !a.accept(w, r, models.AuditViewAuditLog, "", r.URL.RawQuery, http.StatusOK) {
+		return
+	}
+	if records == nil {
+		records = []models.AuditRecord{}
+	}
+	render.JSON(w, r, records)
+}
+
+// DeniedAudit write request rejected by middlewares.AdminAuth to audit log, admin is unknown for it
+func (a *AdminController) DeniedAudit(r *http.Request, reason string) {
+	_ = a.audit(r, models.AuditAccessDenied, r.Method+" "+r.URL.Path, reason, models.AuditOutcomeDenied, http.StatusUnauthorized)
+}
+
+// accept write done action to audit log before answer. When record is not written
+// error is answered and false is returned, so admin knows action is not audited
+func (a *AdminController) accept(w http.ResponseWriter, r *http.Request, action string, target string, detail string, status int) bool {
+	if err := a.audit(r, action, target, detail, models.AuditOutcomeSuccess, status); err != nil {
+		_ = server.Render(w, r, server.ErrAudit(err))
+		return false
+	}
+	return true
+}
+
+// reject write failed attempt of action to audit log and answer problem,
+// failure of audit is only logged here, request is failed anyway
+func (a *AdminController) reject(w http.ResponseWriter, r *http.Request, action string, target string, detail string, problem render.Renderer) {
+	outcome, status := models.AuditOutcomeFailure, http.StatusInternalServerError
+	if e, ok := problem.(*server.ErrResponse); ok {
+		status = e.HTTPStatusCode
+	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		outcome = models.AuditOutcomeDenied
+	}
+	_ = a.audit(r, action, target, detail, outcome, status)
+	_ = server.Render(w, r, problem)
+}
+
+// audit write admin action with its outcome, error is logged and returned
+func (a *AdminController) audit(r *http.Request, action string, target string, detail string, outcome string, status int) error {
+	newUUID, _ := uuid.NewV7()
+	err := a.URLStore.NewAuditRecord(r.Context(), models.AuditRecord{
+		ID:         newUUID.String(),
+		Admin:      middlewares.AdminFromContext(r.Context()),
+		Action:     action,
+		Target:     target,
+		Detail:     detail,
+		Outcome:    outcome,
+		Status:     status,
+		DateCreate: time.Now().UTC(),
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("action", action).Str("target", target).Msg("NewAuditRecord error")
+	}
+	return err
+}
+
+func (a *AdminController) urlResponse(redirect models.Redirect) models.AdminURLResponse {
+	return models.AdminURLResponse{
+		Slug:        redirect.Redirect,
+		ShortURL:    a.URLStore.MakeFullURL(redirect.Redirect),
+		OriginalURL: redirect.URL,
+		User:        redirect.User,
+		IsDeleted:   redirect.IsDelete == 1,
+		DateCreate:  formatDate(redirect.DateCreate),
+	}
+}
+
+// decodeAdminAction read optional body of admin action
+func decodeAdminAction(r *http.Request) (req models.AdminActionRequest, err error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil || len(data) == 0 {
+		return req, err
+	}
+	err = json.Unmarshal(data, &req)
+	return req, err
+}
@@ -0,0 +1,126 @@
+// Package controllers contain server handlers and proxy requests to store
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/gofrs/uuid"
+
+	"github.com/Aligator77/go_practice/internal/auth"
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/models"
+	"github.com/Aligator77/go_practice/internal/server"
+	"github.com/Aligator77/go_practice/internal/stores"
+)
+
+// authenticateAPIKey return owner of key, unknown and revoked keys are invalid tokens
+func (u *URLController) authenticateAPIKey(ctx context.Context, token string, scope string) (userID string, err error) {
+	key, err := u.URLStore.GetAPIKeyByHash(ctx, auth.HashAPIKey(token))
+	if errors.Is(err, stores.ErrAPIKeyNotFound) {
+		return "", auth.ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+	if !key.HasScope(scope) {
+		return "", auth.ErrScope
+	}
+
+	now := time.Now()
+	if key.LastUsed == nil || now.Sub(*key.LastUsed) > apiKeyTouchInterval {
+		if err := u.URLStore.TouchAPIKey(ctx, key, now); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("id", key.ID).Msg("TouchAPIKey error")
+		}
+	}
+	return key.UserID, nil
+}
+
+func (u *URLController) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// api keys are managed only with user cookie, leaked key must not create new ones
+	if _, ok := auth.BearerToken(r); ok {
+		_ = server.Render(w, r, server.ErrForbidden)
+		return
+	}
+	userID, err := u.GetUserID(w, r, "")
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
+
+	data := &models.APIKeyRequest{}
+	if err := render.Bind(r, data); err != nil {
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
+		return
+	}
+
+	newUUID, _ := uuid.NewV7()
+	token, prefix := auth.GenerateAPIKey()
+	key := models.APIKey{
+		ID:         newUUID.String(),
+		UserID:     userID,
+		Name:       data.Name,
+		Prefix:     prefix,
+		Hash:       auth.HashAPIKey(token),
+		Scopes:     data.Scopes,
+		DateCreate: time.Now().UTC(),
+	}
+	if err := u.URLStore.NewAPIKey(r.Context(), key); err != nil {
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, models.APIKeyResponse{APIKey: key, Key: token})
+}
+
+func (u *URLController) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, ok := auth.BearerToken(r); ok {
+		_ = server.Render(w, r, server.ErrForbidden)
+		return
+	}
+	userID, err := u.authenticate(w, r, "")
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
+
+	keys, err := u.URLStore.GetAPIKeysByUser(r.Context(), userID)
+	if err != nil {
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+	render.JSON(w, r, keys)
+}
+
+func (u *URLController) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.BearerToken(r); ok {
+		_ = server.Render(w, r, server.ErrForbidden)
+		return
+	}
+	userID, err := u.authenticate(w, r, "")
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
+
+	err = u.URLStore.RevokeAPIKey(r.Context(), chi.URLParam(r, "id"), userID)
+	if errors.Is(err, stores.ErrAPIKeyNotFound) {
+		_ = server.Render(w, r, server.ErrNotFound)
+		return
+	}
+	if err != nil {
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,12 +3,14 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
-	"github.com/go-chi/render"
 	"github.com/pressly/goose/v3"
 
 	"github.com/Aligator77/go_practice/internal/config"
+	"github.com/Aligator77/go_practice/internal/helpers"
+	"github.com/Aligator77/go_practice/internal/server"
 	"github.com/Aligator77/go_practice/migrations"
 )
 
@@ -26,17 +28,18 @@ func NewDBController(ctx context.Context, db *config.ConnectionPool) *DBControll
 
 func (d *DBController) CheckConnectHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	status := d.DB.CheckConnection(d.Context)
+	status := d.DB.CheckConnection(r.Context())
 	if !status {
-		render.Status(r, http.StatusInternalServerError)
-		w.WriteHeader(http.StatusInternalServerError)
+		_ = server.Render(w, r, server.ErrStorage(errors.New("database is unavailable")))
 	}
 
 }
 
-func (d *DBController) Migrate(ctx context.Context) (result []*goose.MigrationResult, err error) {
+// Migrate apply sql migrations and go migrations, canonical are options of canonical urls of store
+func (d *DBController) Migrate(ctx context.Context, canonical helpers.CanonicalOptions) (result []*goose.MigrationResult, err error) {
 	if d.DB.DisableDBStore == "0" {
-		provider, err := goose.NewProvider("postgres", d.DB.DB(), migrations.Embed)
+		provider, err := goose.NewProvider("postgres", d.DB.DB(), migrations.Embed,
+			goose.WithGoMigrations(migrations.CanonicalBackfill(canonical)))
 		if err != nil {
 			return nil, err
 		}
@@ -2,44 +2,99 @@
 package controllers
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gofrs/uuid"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Aligator77/go_practice/internal/auth"
 	"github.com/Aligator77/go_practice/internal/helpers"
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/metrics"
+	"github.com/Aligator77/go_practice/internal/middlewares"
 	"github.com/Aligator77/go_practice/internal/models"
+	"github.com/Aligator77/go_practice/internal/policy"
 	"github.com/Aligator77/go_practice/internal/server"
 	"github.com/Aligator77/go_practice/internal/stores"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 )
 
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	defaultBatchMaxItems    = 1000
+	defaultBatchMaxBodySize = 1 << 20
+
+	userCookieName  = "user"
+	defaultTokenTTL = 365 * 24 * time.Hour
+
+	// apiKeyTouchInterval limit writes of api key last usage time
+	apiKeyTouchInterval = time.Minute
+	// rateLimitUserAge is age of cookie, after which user gets own rate limit instead of limit of ip
+	rateLimitUserAge = time.Hour
+)
+
+// errBrokenCookie wrap rejected user cookie, it is removed from browser, see authenticate
+var errBrokenCookie = errors.New("user cookie is removed")
+
+// policyCodes map destination policy errors to application error codes
+var policyCodes = map[error]int64{
+	policy.ErrScheme:          server.CodeSchemeNotAllowed,
+	policy.ErrDomainBlocked:   server.CodeDomainBlocked,
+	policy.ErrDomainNotListed: server.CodeDomainNotAllowed,
+	policy.ErrPrivateAddress:  server.CodePrivateAddress,
+	policy.ErrSelfReference:   server.CodeSelfReference,
+	policy.ErrNestedShortLink: server.CodeNestedShortLink,
+}
+
 type URLController struct {
-	URLStore *stores.URLStore
+	URLStore         *stores.URLStore
+	BatchMaxItems    int          // limit of items in one batch request
+	BatchMaxBodySize int64        // limit of batch request body in bytes
+	Signer           *auth.Signer // sign user cookie
+	CookieSecure     bool         // send user cookie only over https
 }
 
+// NewURLController create controller with signer of random key, it must be replaced
+// by signer with key from config, otherwise users lose their links after restart
 func NewURLController(URLService *stores.URLStore) *URLController {
+	signer, _ := auth.NewSigner([]auth.Key{auth.RandomKey()}, defaultTokenTTL)
 	return &URLController{
-		URLStore: URLService,
+		URLStore:         URLService,
+		BatchMaxItems:    defaultBatchMaxItems,
+		BatchMaxBodySize: defaultBatchMaxBodySize,
+		Signer:           signer,
 	}
 }
 
 func (u *URLController) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	userID := u.GetUserID(w, r) // add for iter15
+	userID, err := u.GetUserID(w, r, models.ScopeCreate) // add for iter15
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
 
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		_ = render.Render(w, r, server.ErrInvalidRequest(err))
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
 		return
 	}
-	validateURL, err := helpers.ValidateURL(string(data))
-	if !validateURL || err != nil {
-		u.URLStore.Logger.Err(err).Msg("Write error CreatePostHandler")
+	if err := u.URLStore.ValidateDestination(r.Context(), string(data)); err != nil {
+		logging.FromContext(r.Context()).Err(err).Msg("ValidateDestination error CreatePostHandler")
+		_ = server.Render(w, r, destinationError(err))
 		return
 	}
 	newRedirect := helpers.GenerateRandomURL(10)
@@ -55,21 +110,27 @@ func (u *URLController) CreatePostHandler(w http.ResponseWriter, r *http.Request
 		User:       userID,
 	}
 
-	existRedirect, _ := u.URLStore.GetRedirectByURL(redirect.URL)
+	existRedirect, _ := u.URLStore.GetRedirectByURL(r.Context(), redirect.URL)
 	if len(existRedirect.URL) > 0 {
-		render.Status(r, http.StatusConflict)
+		// text api answers conflict with plain short link, as clients of this route expect
 		w.WriteHeader(http.StatusConflict)
 
 		_, err = w.Write([]byte(u.URLStore.MakeFullURL(existRedirect.Redirect)))
 		if err != nil {
-			u.URLStore.Logger.Err(err).Msg("Write error CreatePostHandler")
+			logging.FromContext(r.Context()).Err(err).Msg("Write error CreatePostHandler")
 		}
+		return
+	}
 
+	unlock, ok := u.reserveLink(w, r, userID)
+	if !ok {
 		return
 	}
+	defer unlock()
 
-	_, err = u.URLStore.NewRedirect(*redirect)
+	_, err = u.URLStore.NewRedirect(r.Context(), *redirect)
 	if err != nil {
+		_ = server.Render(w, r, server.ErrStorage(err))
 		return
 	}
 
@@ -84,17 +145,21 @@ func (u *URLController) CreatePostHandler(w http.ResponseWriter, r *http.Request
 
 func (u *URLController) CreateRestHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	userID := u.GetUserID(w, r) // add for iter15
+	userID, err := u.GetUserID(w, r, models.ScopeCreate) // add for iter15
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
 
 	data := &models.URLData{}
 	if err := render.Bind(r, data); err != nil {
-		_ = render.Render(w, r, server.ErrInvalidRequest(err))
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
 		return
 	}
 
-	validateURL, err := helpers.ValidateURL(data.URL)
-	if !validateURL || err != nil {
-		u.URLStore.Logger.Err(err).Msg("Write error CreatePostHandler")
+	if err := u.URLStore.ValidateDestination(r.Context(), data.URL); err != nil {
+		logging.FromContext(r.Context()).Err(err).Msg("ValidateDestination error CreateRestHandler")
+		_ = server.Render(w, r, destinationError(err))
 		return
 	}
 	newUUID, _ := uuid.NewV7()
@@ -109,20 +174,23 @@ func (u *URLController) CreateRestHandler(w http.ResponseWriter, r *http.Request
 		User:       userID,
 	}
 
-	existRedirect, _ := u.URLStore.GetRedirectByURL(redirect.URL)
+	existRedirect, _ := u.URLStore.GetRedirectByURL(r.Context(), redirect.URL)
 
 	if len(existRedirect.URL) > 0 {
-		render.Status(r, http.StatusConflict)
-		w.WriteHeader(http.StatusConflict)
+		_ = server.Render(w, r, server.ErrURLConflict(u.URLStore.MakeFullURL(existRedirect.Redirect)))
+		return
+	}
 
-		res := models.URLDataResponse{Result: u.URLStore.MakeFullURL(existRedirect.Redirect)}
-		render.JSON(w, r, res)
+	unlock, ok := u.reserveLink(w, r, userID)
+	if !ok {
 		return
 	}
+	defer unlock()
 
-	_, err = u.URLStore.NewRedirect(*redirect)
+	_, err = u.URLStore.NewRedirect(r.Context(), *redirect)
 
 	if err != nil {
+		_ = server.Render(w, r, server.ErrStorage(err))
 		return
 	}
 
@@ -134,158 +202,258 @@ func (u *URLController) CreateRestHandler(w http.ResponseWriter, r *http.Request
 
 func (u *URLController) CreateBatchHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	userID := u.GetUserID(w, r)
+	userID, err := u.GetUserID(w, r, models.ScopeCreate)
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
 
 	data := &models.URLBatchData{}
-	links, err := io.ReadAll(r.Body)
+	links, err := io.ReadAll(http.MaxBytesReader(w, r.Body, u.BatchMaxBodySize))
 	if err != nil {
-		_ = render.Render(w, r, server.ErrInvalidRequest(err))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			_ = server.Render(w, r, server.ErrPayloadTooLarge)
+			return
+		}
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
 		return
 	}
 	err = json.Unmarshal(links, &data)
 	if err != nil {
-		_ = render.Render(w, r, server.ErrInvalidRequest(err))
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
+		return
+	}
+	if len(*data) == 0 {
+		_ = server.Render(w, r, server.ErrInvalidRequest(errors.New("batch is empty")))
+		return
+	}
+	if len(*data) > u.BatchMaxItems {
+		_ = server.Render(w, r, server.ErrInvalidRequest(fmt.Errorf("batch can contain at most %d items", u.BatchMaxItems)))
 		return
 	}
+
+	// correlation id is the only way to match response with request items, so it must be unique
+	correlationIDs := make(map[string]struct{}, len(*data))
+	for _, d := range *data {
+		if _, ok := correlationIDs[d.CorrelationID]; ok || len(d.CorrelationID) == 0 {
+			_ = server.Render(w, r, server.ErrInvalidRequest(fmt.Errorf("correlation_id %q is empty or duplicated", d.CorrelationID)))
+			return
+		}
+		correlationIDs[d.CorrelationID] = struct{}{}
+	}
+
 	var redirects []*models.Redirect
-	var jsonResults []models.URLBatchResponse
+	jsonResults := make([]models.URLBatchResponse, 0, len(*data))
+	batchURLs := make(map[string]string, len(*data))
+	failed := 0
 
 	for _, d := range *data {
-		var resData models.URLBatchResponse
-		newRedirect := helpers.GenerateRandomURL(10)
+		resData := models.URLBatchResponse{CorrelationID: d.CorrelationID}
 
-		validateURL, err := helpers.ValidateURL(d.OriginalURL)
-		if !validateURL || err != nil {
-			u.URLStore.Logger.Err(err).Msg("Write error CreatePostHandler")
-			return
+		if err := u.URLStore.ValidateDestination(r.Context(), d.OriginalURL); err != nil {
+			resData.Error = "invalid original_url: " + err.Error()
+			jsonResults = append(jsonResults, resData)
+			failed++
+			continue
 		}
+
+		// the same url is shortened once, both inside batch and across stored links
+		canonicalURL := u.URLStore.CanonicalURL(d.OriginalURL)
+		if slug, ok := batchURLs[canonicalURL]; ok {
+			resData.ShortURL = u.URLStore.MakeFullURL(slug)
+			jsonResults = append(jsonResults, resData)
+			continue
+		}
+		existRedirect, _ := u.URLStore.GetRedirectByURL(r.Context(), d.OriginalURL)
+		if len(existRedirect.URL) > 0 {
+			resData.ShortURL = u.URLStore.MakeFullURL(existRedirect.Redirect)
+			jsonResults = append(jsonResults, resData)
+			continue
+		}
+
+		newUUID, _ := uuid.NewV7()
+		newRedirect := helpers.GenerateRandomURL(10)
 		redirect := &models.Redirect{
-			ID:         d.CorrelationID,
-			IsDelete:   0, // change for iter15
-			URL:        d.OriginalURL,
-			Redirect:   newRedirect,
-			DateCreate: time.Now().String(),
-			DateUpdate: time.Now().String(),
-			User:       userID,
+			ID:           newUUID.String(),
+			IsDelete:     0, // change for iter15
+			URL:          d.OriginalURL,
+			Redirect:     newRedirect,
+			DateCreate:   time.Now().String(),
+			DateUpdate:   time.Now().String(),
+			User:         userID,
+			CanonicalURL: canonicalURL,
 		}
-		resData.CorrelationID = d.CorrelationID
+		batchURLs[canonicalURL] = newRedirect
 		resData.ShortURL = u.URLStore.MakeFullURL(newRedirect)
 
 		redirects = append(redirects, redirect)
 		jsonResults = append(jsonResults, resData)
 	}
 
-	if u.URLStore.DisableDB == "0" {
-
-		_, err := u.URLStore.NewRedirectsBatch(redirects)
+	if len(redirects) > 0 {
+		allowed, unlock, err := u.URLStore.ReserveLinks(r.Context(), userID, len(redirects))
 		if err != nil {
+			_ = server.Render(w, r, server.ErrStorage(err))
 			return
 		}
+		defer unlock()
+		if allowed < len(redirects) {
+			// links over quota are reported as failed items, the rest of batch is created
+			rejected := make(map[string]struct{}, len(redirects)-allowed)
+			for _, redirect := range redirects[allowed:] {
+				rejected[u.URLStore.MakeFullURL(redirect.Redirect)] = struct{}{}
+			}
+			redirects = redirects[:allowed]
+			for i := range jsonResults {
+				if _, ok := rejected[jsonResults[i].ShortURL]; ok {
+					jsonResults[i].ShortURL = ""
+					jsonResults[i].Error = stores.ErrQuotaExceeded.Error()
+					failed++
+				}
+			}
+		}
+	}
 
+	_, err = u.URLStore.NewRedirectsBatch(r.Context(), redirects)
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Msg("CreateBatchHandler NewRedirectsBatch error")
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
 	}
 
-	render.Status(r, http.StatusCreated)
-	w.WriteHeader(http.StatusCreated)
+	status := http.StatusCreated
+	if failed == len(jsonResults) {
+		status = http.StatusBadRequest
+	} else if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	render.Status(r, status)
+	w.WriteHeader(status)
 	render.JSON(w, r, jsonResults)
 }
 
 func (u *URLController) GetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
-	_ = u.GetUserID(w, r)
+	// redirect does not depend on user, so broken cookie is not an error here
+	_, _ = u.GetUserID(w, r, "")
 
 	id := chi.URLParam(r, "id")
-	u.URLStore.Logger.Warn().Str("id", id).Msg("GetHandler request")
+	logging.FromContext(r.Context()).Warn().Str("id", id).Msg("GetHandler request")
 
-	if len(id) > 0 {
-
-		redirect, err := u.URLStore.GetRedirect(id)
-		if err != nil {
-			u.URLStore.Logger.Error().Err(err).Str("data", id).Msg("GetRedirect error")
-
-			http.Error(w, "GetRedirect error", http.StatusBadRequest)
-		}
+	if len(id) == 0 {
+		logging.FromContext(r.Context()).Error().Str("data", id).Msg("GetRedirect not found id empty")
+		_ = server.Render(w, r, server.ErrInvalidRequest(errors.New("short link is empty")))
+		return
+	}
 
-		if redirect.Redirect != "" && redirect.IsDelete == 0 { // change for iter15
-			fullRedirect := u.URLStore.MakeFullURL(redirect.URL)
-			u.URLStore.Logger.Warn().Strs("data", []string{id, redirect.URL, redirect.Redirect, strconv.Itoa(redirect.IsDelete)}).Msg("GetRedirect success")
+	redirect, err := u.URLStore.GetRedirect(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("data", id).Msg("GetRedirect error")
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
 
-			w.Header().Set("Location", fullRedirect)
-			w.WriteHeader(http.StatusTemporaryRedirect)
-			http.Redirect(w, r, fullRedirect, http.StatusTemporaryRedirect)
-		} else if redirect.IsDelete == 1 { // add for iter15
-			render.Status(r, http.StatusGone)
-			w.WriteHeader(http.StatusGone)
-			u.URLStore.Logger.Error().Err(err).Strs("data", []string{id, redirect.URL, redirect.Redirect, strconv.Itoa(redirect.IsDelete)}).Msg("GetRedirect is deleted")
-		} else {
-			u.URLStore.Logger.Error().Err(err).Strs("data", []string{id, redirect.URL, redirect.Redirect, strconv.Itoa(redirect.IsDelete)}).Msg("GetRedirect not found")
-		}
+	if redirect.Redirect != "" && redirect.IsDelete == 0 && !redirect.Expired() { // change for iter15
+		fullRedirect := u.URLStore.MakeFullURL(redirect.URL)
+		logging.FromContext(r.Context()).Warn().Strs("data", []string{id, redirect.URL, redirect.Redirect, strconv.Itoa(redirect.IsDelete)}).Msg("GetRedirect success")
+
+		metrics.Redirects.WithLabelValues(metrics.RedirectHit).Inc()
+		w.Header().Set("Location", fullRedirect)
+		w.WriteHeader(http.StatusTemporaryRedirect)
+		http.Redirect(w, r, fullRedirect, http.StatusTemporaryRedirect)
+	} else if redirect.IsDelete == 1 || redirect.Expired() { // add for iter15
+		logging.FromContext(r.Context()).Error().Strs("data", []string{id, redirect.URL, redirect.Redirect, strconv.Itoa(redirect.IsDelete)}).Msg("GetRedirect is deleted")
+		metrics.Redirects.WithLabelValues(metrics.RedirectGone).Inc()
+		_ = server.Render(w, r, server.ErrGone)
 	} else {
-		u.URLStore.Logger.Error().Str("data", id).Msg("GetRedirect not found id empty")
-		http.Error(w, "GetRedirect error", http.StatusBadRequest)
+		logging.FromContext(r.Context()).Error().Strs("data", []string{id, redirect.URL, redirect.Redirect, strconv.Itoa(redirect.IsDelete)}).Msg("GetRedirect not found")
+		metrics.Redirects.WithLabelValues(metrics.RedirectMiss).Inc()
+		_ = server.Render(w, r, server.ErrNotFound)
 	}
 }
 
 func (u *URLController) CreateFullRestHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	method := r.Method
-	cookie, err := r.Cookie("user") // add for iter15
-	if err != nil && !errors.Is(err, http.ErrNoCookie) {
-		_ = render.Render(w, r, server.ErrInvalidRequest(err))
+	var userID string
+	var err error
+	switch method {
+	case http.MethodGet:
+		// user without cookie has no links yet, so new user is not created for listing
+		userID, err = u.authenticate(w, r, models.ScopeRead) // add for iter15
+	case http.MethodDelete:
+		userID, err = u.GetUserID(w, r, models.ScopeDelete)
+	default:
+		userID, err = u.GetUserID(w, r, models.ScopeCreate)
+	}
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
 		return
 	}
-	userID := u.GetUserID(w, r)
 
 	switch method {
 	case http.MethodGet:
-		if len(cookie.String()) > 0 && len(cookie.Value) > 0 { // add for iter15
-
-			existRedirects, err := u.URLStore.GetRedirectsByUser(cookie.Value)
-			if err != nil {
-				u.URLStore.Logger.Err(err).Str("cookie data", cookie.String()).Msg("error with cookie user")
-			}
-			if len(existRedirects) == 0 {
-				render.Status(r, http.StatusNoContent)
-				w.WriteHeader(http.StatusNoContent)
-				return
-			}
-			var jsonResults []models.URLBatchResponse
-			for _, e := range existRedirects {
-				redirect := models.URLBatchResponse{
-					ShortURL:    u.URLStore.MakeFullURL(e.Redirect),
-					OriginalURL: e.URL,
-				}
-				jsonResults = append(jsonResults, redirect)
-			}
-
-			render.JSON(w, r, jsonResults)
+		filter, err := parseURLListFilter(r.URL.Query())
+		if err != nil {
+			_ = server.Render(w, r, server.ErrInvalidRequest(err))
+			return
+		}
+		existRedirects, next, err := u.URLStore.GetRedirectsByUserPage(r.Context(), userID, filter)
+		if errors.Is(err, stores.ErrInvalidCursor) {
+			_ = server.Render(w, r, server.ErrInvalidRequest(err))
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Err(err).Str("user", userID).Msg("GetRedirectsByUserPage error")
+			_ = server.Render(w, r, server.ErrStorage(err))
+			return
+		}
+		if len(next) > 0 {
+			nextQuery := r.URL.Query()
+			nextQuery.Set("cursor", next)
+			w.Header().Set("X-Next-Cursor", next)
+			w.Header().Set("Link", `<`+r.URL.Path+"?"+nextQuery.Encode()+`>; rel="next"`)
 		}
-		auth := r.Header.Get("Authorization")
-		if len(cookie.String()) == 0 { // add for iter15
+		if len(existRedirects) == 0 {
 			render.Status(r, http.StatusNoContent)
 			w.WriteHeader(http.StatusNoContent)
+			return
 		}
-
-		if len(auth) == 0 {
-			render.Status(r, http.StatusUnauthorized)
-			w.WriteHeader(http.StatusUnauthorized)
+		var jsonResults []models.URLBatchResponse
+		for _, e := range existRedirects {
+			redirect := models.URLBatchResponse{
+				ShortURL:    u.URLStore.MakeFullURL(e.Redirect),
+				OriginalURL: e.URL,
+			}
+			jsonResults = append(jsonResults, redirect)
 		}
+
+		render.JSON(w, r, jsonResults)
 	case http.MethodDelete:
 		data, err := io.ReadAll(r.Body)
 		if err != nil {
-			_ = render.Render(w, r, server.ErrInvalidRequest(err))
+			_ = server.Render(w, r, server.ErrInvalidRequest(err))
 			return
 		}
 		var urls []string
-		json.Unmarshal(data, &urls)
+		if err := json.Unmarshal(data, &urls); err != nil {
+			_ = server.Render(w, r, server.ErrInvalidRequest(err))
+			return
+		}
 
-		go u.URLStore.DeleteRedirect(urls)
+		u.URLStore.DeleteRedirectAsync(r.Context(), userID, urls)
 
 		render.Status(r, http.StatusAccepted)
 		w.WriteHeader(http.StatusAccepted)
 	case http.MethodPost:
 		data := &models.URLData{}
 		if err := render.Bind(r, data); err != nil {
-			_ = render.Render(w, r, server.ErrInvalidRequest(err))
+			_ = server.Render(w, r, server.ErrInvalidRequest(err))
+			return
+		}
+		if err := u.URLStore.ValidateDestination(r.Context(), data.URL); err != nil {
+			_ = server.Render(w, r, destinationError(err))
 			return
 		}
 		newUUID, _ := uuid.NewV7()
@@ -300,42 +468,546 @@ func (u *URLController) CreateFullRestHandler(w http.ResponseWriter, r *http.Req
 			User:       userID,
 		}
 
-		existRedirect, _ := u.URLStore.GetRedirectByURL(newRedirect.URL)
+		existRedirect, _ := u.URLStore.GetRedirectByURL(r.Context(), newRedirect.URL)
 
 		if len(existRedirect.URL) > 0 {
-			render.Status(r, http.StatusConflict)
-			w.WriteHeader(http.StatusConflict)
+			_ = server.Render(w, r, server.ErrURLConflict(u.URLStore.MakeFullURL(existRedirect.Redirect)))
+			return
+		}
 
-			res := models.URLDataResponse{Result: u.URLStore.MakeFullURL(existRedirect.Redirect)}
-			render.JSON(w, r, res)
+		unlock, ok := u.reserveLink(w, r, userID)
+		if !ok {
 			return
 		}
+		defer unlock()
 
-		_, err := u.URLStore.NewRedirect(*newRedirect)
+		_, err := u.URLStore.NewRedirect(r.Context(), *newRedirect)
 
 		if err != nil {
+			_ = server.Render(w, r, server.ErrStorage(err))
 			return
 		}
 
+		render.Status(r, http.StatusCreated)
+		w.WriteHeader(http.StatusCreated)
+		res := models.URLDataResponse{Result: u.URLStore.MakeFullURL(newRedirectURL)}
+		render.JSON(w, r, res)
+	}
+
+}
+
+func (u *URLController) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID, err := u.GetUserID(w, r, models.ScopeCreate)
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
+	id := chi.URLParam(r, "id")
+
+	data := &models.URLData{}
+	if err := render.Bind(r, data); err != nil {
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
+		return
+	}
+	if err := u.URLStore.ValidateDestination(r.Context(), data.URL); err != nil {
+		logging.FromContext(r.Context()).Err(err).Str("data", data.URL).Msg("ValidateDestination error UpdateHandler")
+		_ = server.Render(w, r, destinationError(err))
+		return
+	}
+
+	redirect, err := u.URLStore.GetRedirect(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("data", id).Msg("UpdateHandler GetRedirect error")
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+	if redirect.Redirect != id {
+		_ = server.Render(w, r, server.ErrNotFound)
+		return
+	}
+	if redirect.User != userID {
+		_ = server.Render(w, r, server.ErrForbidden)
+		return
+	}
+	if redirect.IsDelete == 1 || redirect.Expired() {
+		_ = server.Render(w, r, server.ErrGone)
+		return
+	}
+
+	existRedirect, _ := u.URLStore.GetRedirectByURL(r.Context(), data.URL)
+	if len(existRedirect.URL) > 0 && existRedirect.Redirect != id {
+		_ = server.Render(w, r, server.ErrURLConflict(u.URLStore.MakeFullURL(existRedirect.Redirect)))
+		return
+	}
+
+	updated, err := u.URLStore.UpdateRedirect(r.Context(), id, data.URL, userID)
+	if errors.Is(err, stores.ErrRedirectNotFound) {
+		_ = server.Render(w, r, server.ErrNotFound)
+		return
+	}
+	if errors.Is(err, stores.ErrRedirectGone) {
+		_ = server.Render(w, r, server.ErrGone)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("data", id).Msg("UpdateHandler UpdateRedirect error")
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+
+	res := models.URLBatchResponse{
+		ShortURL:    u.URLStore.MakeFullURL(updated.Redirect),
+		OriginalURL: updated.URL,
+	}
+	render.JSON(w, r, res)
+}
+
+func (u *URLController) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := u.GetUserID(w, r, models.ScopeCreate)
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if len(format) == 0 {
+		switch strings.Split(r.Header.Get("Content-Type"), ";")[0] {
+		case "text/csv":
+			format = stores.ImportFormatCSV
+		case "application/x-ndjson", "application/jsonl":
+			format = stores.ImportFormatJSONL
+		}
+	}
+	reader, err := stores.NewImportReader(format, r.Body)
+	if err != nil {
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
+		return
 	}
 
+	// report is streamed row by row, so status is known only for request itself
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	rows := 0
+
+	err = u.URLStore.ImportRedirects(r.Context(), reader, userID, stores.ImportMaxRows, func(result models.URLImportResult) error {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		rows++
+		if flusher != nil && rows%100 == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Int("rows", rows).Msg("ImportHandler import stopped")
+	}
 }
 
-func (u *URLController) GetUserID(w http.ResponseWriter, r *http.Request) (userID string) { // add for iter15
-	cookie, err := r.Cookie("user")
-	if err != nil && !errors.Is(err, http.ErrNoCookie) {
-		u.URLStore.Logger.Err(err).Msg("error with cookie user")
-		return userID
-	}
-	if len(cookie.String()) == 0 {
-		expiration := time.Now().Add(365 * 24 * time.Hour)
-		newUserID, _ := uuid.NewV7()
-		newCookie := http.Cookie{Name: "user", Value: newUserID.String(), Expires: expiration}
-		http.SetCookie(w, &newCookie)
-		userID = newUserID.String()
-		w.Header().Set("Authorization", newUserID.String())
+func (u *URLController) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := u.GetUserID(w, r, models.ScopeRead)
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if len(format) == 0 {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatNDJSON {
+		_ = server.Render(w, r, server.ErrInvalidRequest(errors.New("format must be csv or ndjson")))
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	rows := 0
+	var write func(models.URLExportRow) error
+	finish := func() {}
+
+	if format == exportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="urls.csv"`)
+		writer := csv.NewWriter(w)
+		_ = writer.Write(models.URLExportHeader)
+		write = func(row models.URLExportRow) error {
+			if err := writer.Write(row.Record()); err != nil {
+				return err
+			}
+			if rows%100 == 0 {
+				writer.Flush()
+			}
+			return writer.Error()
+		}
+		finish = writer.Flush
 	} else {
-		userID = cookie.Value
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="urls.ndjson"`)
+		encoder := json.NewEncoder(w)
+		write = func(row models.URLExportRow) error {
+			return encoder.Encode(row)
+		}
+	}
+
+	err = u.URLStore.EachRedirectByUser(r.Context(), userID, func(redirect models.Redirect) error {
+		rows++
+		err := write(models.URLExportRow{
+			Slug:        redirect.Redirect,
+			ShortURL:    u.URLStore.MakeFullURL(redirect.Redirect),
+			OriginalURL: redirect.URL,
+			DateCreate:  formatDate(redirect.DateCreate),
+			DateUpdate:  formatDate(redirect.DateUpdate),
+			IsDeleted:   redirect.IsDelete == 1,
+		})
+		if flusher != nil && rows%100 == 0 {
+			flusher.Flush()
+		}
+		return err
+	})
+	if err == nil {
+		finish()
+		return
+	}
+	logging.FromContext(r.Context()).Error().Err(err).Int("rows", rows).Msg("ExportHandler export stopped")
+	if rows == 0 {
+		// nothing is sent yet, so client gets usual error instead of empty file
+		w.Header().Del("Content-Disposition")
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+	// connection is closed without last chunk, so client can see that file is incomplete
+	panic(http.ErrAbortHandler)
+}
+
+// GetUserID return owner of api key from Authorization header or user from signed cookie,
+// request without both gets new user and cookie. Error is returned for forged or expired credentials,
+// auth.ErrScope for api key without scope and stores.ErrUserBlocked for blocked user, see authError
+func (u *URLController) GetUserID(w http.ResponseWriter, r *http.Request, scope string) (userID string, err error) { // add for iter15
+	userID, err = u.authenticate(w, r, scope)
+	if err == nil && scope == models.ScopeCreate {
+		if err := u.CheckBlocked(r.Context(), userID); err != nil {
+			return "", err
+		}
+	}
+	if !errors.Is(err, auth.ErrNoToken) && !errors.Is(err, errBrokenCookie) {
+		return userID, err
+	}
+	newUserID, _ := uuid.NewV7()
+	u.setUserCookie(w, newUserID.String())
+	logging.SetUserID(r.Context(), newUserID.String())
+	return newUserID.String(), nil
+}
+
+// authenticate verify api key or user cookie of request, see Authenticate
+func (u *URLController) authenticate(w http.ResponseWriter, r *http.Request, scope string) (userID string, err error) {
+	apiKey, _ := auth.BearerToken(r)
+	userToken := ""
+	if cookie, err := r.Cookie(userCookieName); err == nil {
+		userToken = cookie.Value
+	}
+	userID, rotate, err := u.Authenticate(r.Context(), apiKey, userToken, scope)
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpiredToken) {
+		logging.FromContext(r.Context()).Warn().Err(err).Str("ip", r.RemoteAddr).Msg("user credentials are rejected")
+		if len(apiKey) == 0 {
+			// cookie lives long, so broken, expired or legacy unsigned cookie is removed,
+			// otherwise browser gets 401 until it expires. GetUserID replaces it by new user
+			u.expireUserCookie(w)
+			err = fmt.Errorf("%w: %w", errBrokenCookie, err)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if rotate {
+		// cookie of old key is replaced, so the key can be removed from config later
+		u.setUserCookie(w, userID)
+	}
+	logging.SetUserID(r.Context(), userID)
+	return userID, nil
+}
+
+// Authenticate verify api key or signed user token, api key is used when both are given.
+// auth.ErrNoToken is returned when request has none of them. Token gives all scopes, api key only
+// scopes chosen on its creation. rotate tells token is signed by old key and must be replaced
+func (u *URLController) Authenticate(ctx context.Context, apiKey string, userToken string, scope string) (userID string, rotate bool, err error) {
+	if len(apiKey) > 0 {
+		userID, err = u.authenticateAPIKey(ctx, apiKey, scope)
+		return userID, false, err
+	}
+	if len(userToken) == 0 {
+		return "", false, auth.ErrNoToken
+	}
+	return u.Signer.Verify(userToken)
+}
+
+// CheckBlocked return stores.ErrUserBlocked when user can not create or change links,
+// blocked user keeps access to own links
+func (u *URLController) CheckBlocked(ctx context.Context, userID string) error {
+	blocked, err := u.URLStore.IsUserBlocked(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return stores.ErrUserBlocked
+	}
+	return nil
+}
+
+func (u *URLController) setUserCookie(w http.ResponseWriter, userID string) {
+	u.dropUserCookie(w)
+	http.SetCookie(w, &http.Cookie{
+		Name:     userCookieName,
+		Value:    u.Signer.Sign(userID),
+		Path:     "/",
+		Expires:  time.Now().Add(u.Signer.TTL()),
+		HttpOnly: true,
+		Secure:   u.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// expireUserCookie tell browser to remove user cookie
+func (u *URLController) expireUserCookie(w http.ResponseWriter) {
+	u.dropUserCookie(w)
+	http.SetCookie(w, &http.Cookie{
+		Name:     userCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   u.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// dropUserCookie remove user cookie set before in this response, so response has only one of them
+func (u *URLController) dropUserCookie(w http.ResponseWriter) {
+	values := w.Header().Values("Set-Cookie")
+	if len(values) == 0 {
+		return
+	}
+	w.Header().Del("Set-Cookie")
+	for _, value := range values {
+		if !strings.HasPrefix(value, userCookieName+"=") {
+			w.Header().Add("Set-Cookie", value)
+		}
+	}
+}
+
+func (u *URLController) QRHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	opts, err := parseQROptions(r.URL.Query())
+	if err != nil {
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
+		return
+	}
+
+	redirect, err := u.URLStore.GetRedirect(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("data", id).Msg("QRHandler GetRedirect error")
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+	if redirect.Redirect == "" {
+		_ = server.Render(w, r, server.ErrNotFound)
+		return
+	}
+	if redirect.IsDelete == 1 || redirect.Expired() {
+		_ = server.Render(w, r, server.ErrGone)
+		return
+	}
+
+	fullURL := u.URLStore.MakeFullURL(redirect.Redirect)
+	// qr code depends only on short link and options, so it can be cached by clients
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s|%d|%d|%s|%s", fullURL, opts.Size, opts.Margin, opts.Level, opts.Format)))
+	etag := `"` + hex.EncodeToString(hash[:]) + `"`
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match == etag || match == "*" {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	img, err := helpers.GenerateQR(fullURL, opts)
+	if errors.Is(err, helpers.ErrQRTooSmall) {
+		_ = server.Render(w, r, server.ErrInvalidRequest(err))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Err(err).Str("data", fullURL).Msg("QRHandler GenerateQR error")
+		_ = server.Render(w, r, server.ErrInternal(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", opts.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(img)
+	if err != nil {
+		logging.FromContext(r.Context()).Err(err).Msg("Write error QRHandler")
+	}
+}
+
+// reserveLink lock quota of user for one new link, response is rendered when link can not be created
+func (u *URLController) reserveLink(w http.ResponseWriter, r *http.Request, userID string) (unlock func(), ok bool) {
+	allowed, unlock, err := u.URLStore.ReserveLinks(r.Context(), userID, 1)
+	if err != nil {
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return nil, false
+	}
+	if allowed < 1 {
+		unlock()
+		_ = server.Render(w, r, server.ErrQuotaExceeded)
+		return nil, false
+	}
+	return unlock, true
+}
+
+// QuotaHandler show quota of user and its usage
+func (u *URLController) QuotaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID, err := u.authenticate(w, r, models.ScopeStats)
+	if err != nil {
+		_ = server.Render(w, r, authError(err))
+		return
+	}
+
+	quota, err := u.URLStore.GetUserQuota(r.Context(), userID)
+	if err != nil {
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+	usage, err := u.URLStore.GetQuotaUsage(r.Context(), userID)
+	if err != nil {
+		_ = server.Render(w, r, server.ErrStorage(err))
+		return
+	}
+	render.JSON(w, r, models.QuotaResponse{
+		Quota:        quota,
+		QuotaUsage:   usage,
+		DailyResetAt: stores.QuotaDayStart(time.Now()).Add(24 * time.Hour),
+	})
+}
+
+// RateLimitKey identify client of request for rate limiter, see ClientKey
+func (u *URLController) RateLimitKey(r *http.Request) string {
+	_, withAPIKey := auth.BearerToken(r)
+	userToken := ""
+	if cookie, err := r.Cookie(userCookieName); err == nil {
+		userToken = cookie.Value
+	}
+	return u.ClientKey(withAPIKey, userToken, middlewares.ClientIP(r))
+}
+
+// ClientKey identify client for rate limiter: user of token signed at least rateLimitUserAge ago,
+// otherwise client ip. Anybody gets new token by one request, so new users are limited by ip, the same as
+// requests without token. Api keys are not checked here, so random bearer tokens can not bypass limit of ip
+func (u *URLController) ClientKey(withAPIKey bool, userToken string, ip string) string {
+	if !withAPIKey && len(userToken) > 0 {
+		if userID, issued, err := u.Signer.Issued(userToken); err == nil && time.Since(issued) >= rateLimitUserAge {
+			return "user:" + userID
+		}
+	}
+	return "ip:" + ip
+}
+
+// authError convert error of GetUserID to response
+func authError(err error) render.Renderer {
+	switch {
+	case errors.Is(err, auth.ErrScope):
+		return server.ErrForbidden
+	case errors.Is(err, stores.ErrUserBlocked):
+		return server.ErrUserBlocked
+	case errors.Is(err, auth.ErrNoToken), errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrExpiredToken):
+		return server.ErrUnauthorized
+	}
+	// api keys are read from store, so its failure must not look like bad credentials
+	return server.ErrStorage(err)
+}
+
+// destinationError convert error of URLStore.ValidateDestination to response
+func destinationError(err error) render.Renderer {
+	for policyErr, code := range policyCodes {
+		if errors.Is(err, policyErr) {
+			return server.ErrPolicy(code, err)
+		}
+	}
+	return server.ErrInvalidURL(err)
+}
+
+// formatDate bring dates of memory and db stores to RFC3339
+func formatDate(date string) string {
+	if t := models.ParseDate(date); !t.IsZero() {
+		return t.Format(time.RFC3339Nano)
+	}
+	return date
+}
+
+// parseQROptions read size, margin, level and format from query, missing params take default values
+func parseQROptions(query url.Values) (opts helpers.QROptions, err error) {
+	opts = helpers.DefaultQROptions()
+	if size := query.Get("size"); len(size) > 0 {
+		if opts.Size, err = strconv.Atoi(size); err != nil {
+			return opts, helpers.ErrQRSize
+		}
+	}
+	if margin := query.Get("margin"); len(margin) > 0 {
+		if opts.Margin, err = strconv.Atoi(margin); err != nil {
+			return opts, helpers.ErrQRMargin
+		}
+	}
+	if level := query.Get("level"); len(level) > 0 {
+		opts.Level = strings.ToUpper(level)
+	}
+	if format := query.Get("format"); len(format) > 0 {
+		opts.Format = strings.ToLower(format)
+	}
+
+	return opts, opts.Validate()
+}
+
+// parseURLListFilter read pagination, filters and order of user urls listing from query
+func parseURLListFilter(query url.Values) (filter models.URLListFilter, err error) {
+	filter = models.URLListFilter{
+		Status: models.URLStatusAll,
+		Sort:   models.SortAsc,
+		Limit:  models.URLListDefaultLimit,
+		Query:  query.Get("q"),
+		Cursor: query.Get("cursor"),
+	}
+	if limit := query.Get("limit"); len(limit) > 0 {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > models.URLListMaxLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", models.URLListMaxLimit)
+		}
 	}
-	return userID
+	if status := query.Get("status"); len(status) > 0 {
+		if status != models.URLStatusAll && status != models.URLStatusLive && status != models.URLStatusDeleted {
+			return filter, errors.New("status must be one of all, live, deleted")
+		}
+		filter.Status = status
+	}
+	if order := query.Get("sort"); len(order) > 0 {
+		if order != models.SortAsc && order != models.SortDesc {
+			return filter, errors.New("sort must be asc or desc")
+		}
+		filter.Sort = order
+	}
+	if from := query.Get("created_from"); len(from) > 0 {
+		if filter.CreatedFrom, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, errors.New("created_from must be RFC3339 date")
+		}
+	}
+	if to := query.Get("created_to"); len(to) > 0 {
+		if filter.CreatedTo, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, errors.New("created_to must be RFC3339 date")
+		}
+	}
+
+	return filter, nil
 }
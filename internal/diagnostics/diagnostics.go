@@ -0,0 +1,120 @@
+// Package diagnostics contain handler of debug server: pprof, metrics, goroutine dump,
+// build info and effective config. It must not be mounted on public router
+package diagnostics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"github.com/Aligator77/go_practice/internal/auth"
+	"github.com/Aligator77/go_practice/internal/metrics"
+	"github.com/Aligator77/go_practice/internal/server"
+)
+
+// Options of debug handler, without user and token requests are not checked
+type Options struct {
+	User     string
+	Password string
+	Token    string
+	Version  string
+	// Config return effective config, secrets must be hidden
+	Config func() any
+}
+
+// BuildInfo is answer of /debug/buildinfo
+type BuildInfo struct {
+	Version   string            `json:"version"`
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Module    string            `json:"module_version"`
+	Settings  map[string]string `json:"settings"`
+	Deps      map[string]string `json:"deps"`
+}
+
+// Handler create router of debug server
+func Handler(opts Options) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.NoCache)
+	r.Use(Auth(opts.User, opts.Password, opts.Token))
+
+	r.HandleFunc("/debug/pprof/*", pprof.Index)
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.Handle("/metrics", metrics.Handler())
+	r.Get("/debug/goroutines", Goroutines)
+	r.Get("/debug/buildinfo", buildInfoHandler(opts.Version))
+	r.Get("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, opts.Config())
+	})
+	return r
+}
+
+// Auth pass requests with bearer token or basic auth, when one of them is set.
+// Secrets are compared in constant time
+func Auth(user string, password string, token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(user) == 0 && len(token) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if bearer, ok := auth.BearerToken(r); ok && len(token) > 0 &&
+				subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if u, p, ok := r.BasicAuth(); ok && len(user) > 0 &&
+				subtle.ConstantTimeCompare([]byte(u), []byte(user))&subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(user) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="debug"`)
+			}
+			_ = server.Render(w, r, server.ErrUnauthorized)
+		})
+	}
+}
+
+// Goroutines write stacks of all goroutines as text, ?debug=1 groups equal stacks
+func Goroutines(w http.ResponseWriter, r *http.Request) {
+	level := 2
+	if v, err := strconv.Atoi(r.URL.Query().Get("debug")); err == nil && v == 1 {
+		level = 1
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Goroutines", strconv.Itoa(runtime.NumGoroutine()))
+	_ = rpprof.Lookup("goroutine").WriteTo(w, level)
+}
+
+func buildInfoHandler(version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := BuildInfo{
+			Version:   version,
+			GoVersion: runtime.Version(),
+			Settings:  map[string]string{},
+			Deps:      map[string]string{},
+		}
+		if info, ok := debug.ReadBuildInfo(); ok {
+			res.Path = info.Path
+			res.Module = info.Main.Version
+			for _, s := range info.Settings {
+				res.Settings[s.Key] = s.Value
+			}
+			for _, dep := range info.Deps {
+				res.Deps[dep.Path] = dep.Version
+			}
+		}
+		render.JSON(w, r, res)
+	}
+}
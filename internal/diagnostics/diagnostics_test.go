@@ -0,0 +1,67 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth(t *testing.T) {
+	h := Handler(Options{User: "ops", Password: "pass", Token: "debug-token", Config: func() any { return nil }})
+	get := func(prepare func(r *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/goroutines", nil)
+		prepare(req)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(func(*http.Request) {})
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Без авторизации отладка закрыта")
+	assert.Equal(t, `Basic realm="debug"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, get(func(r *http.Request) { r.SetBasicAuth("ops", "wrong") }).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }).Code)
+	assert.Equal(t, http.StatusOK, get(func(r *http.Request) { r.SetBasicAuth("ops", "pass") }).Code)
+	assert.Equal(t, http.StatusOK, get(func(r *http.Request) { r.Header.Set("Authorization", "Bearer debug-token") }).Code)
+
+	open := Handler(Options{Config: func() any { return nil }})
+	w = httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "Без настроенной авторизации запросы не проверяются")
+}
+
+func TestEndpoints(t *testing.T) {
+	h := Handler(Options{Version: "1.2.3", Config: func() any {
+		return map[string]any{"db_password": "xxxxx"}
+	}})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/debug/goroutines")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine ", "Должен быть дамп стеков горутин")
+	assert.Contains(t, w.Body.String(), "TestEndpoints")
+
+	w = get("/debug/buildinfo")
+	require.Equal(t, http.StatusOK, w.Code)
+	var info BuildInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+
+	w = get("/debug/config")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"db_password":"xxxxx"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusOK, get("/metrics").Code)
+	assert.Equal(t, http.StatusOK, get("/debug/pprof/heap").Code)
+	assert.Equal(t, http.StatusOK, get("/debug/pprof/cmdline").Code)
+}
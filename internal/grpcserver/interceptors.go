@@ -0,0 +1,234 @@
+// Package grpcserver contain gRPC api, it uses the same store and user identification as REST handlers
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/Aligator77/go_practice/internal/auth"
+	"github.com/Aligator77/go_practice/internal/controllers"
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/middlewares"
+	"github.com/Aligator77/go_practice/internal/models"
+	"github.com/Aligator77/go_practice/internal/pb"
+	"github.com/Aligator77/go_practice/internal/stores"
+	"github.com/Aligator77/go_practice/internal/tracing"
+)
+
+// UserTokenHeader is metadata key of signed user token, it has the same value as user cookie
+const UserTokenHeader = "user-token"
+
+// methodAccess describe how user of method is identified, the same as in REST handlers
+type methodAccess struct {
+	scope   string
+	newUser bool // call without credentials gets new user
+}
+
+var methods = map[string]methodAccess{
+	pb.Shortener_Shorten_FullMethodName:        {scope: models.ScopeCreate, newUser: true},
+	pb.Shortener_ShortenBatch_FullMethodName:   {scope: models.ScopeCreate, newUser: true},
+	pb.Shortener_ListUserURLs_FullMethodName:   {scope: models.ScopeRead},
+	pb.Shortener_DeleteUserURLs_FullMethodName: {scope: models.ScopeDelete},
+	pb.Shortener_Stats_FullMethodName:          {scope: models.ScopeStats},
+}
+
+type userCtxKey struct{}
+
+// UserFromContext return user identified by AuthInterceptor
+func UserFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userCtxKey{}).(string)
+	return userID
+}
+
+// AuthInterceptor identify user by api key from "authorization" or signed token from "user-token" metadata.
+// New and re-signed tokens are sent in "user-token" header. Methods without access rules are public
+func AuthInterceptor(users *controllers.URLController) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		access, ok := methods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		apiKey := ""
+		if scheme, token, found := strings.Cut(first(md, "authorization"), " "); found && strings.EqualFold(scheme, "Bearer") {
+			apiKey = strings.TrimSpace(token)
+		}
+		userID, rotate, err := users.Authenticate(ctx, apiKey, first(md, UserTokenHeader), access.scope)
+		if err == nil && access.scope == models.ScopeCreate {
+			err = users.CheckBlocked(ctx, userID)
+		}
+		if errors.Is(err, auth.ErrNoToken) && access.newUser {
+			newUserID, _ := uuid.NewV7()
+			userID, rotate, err = newUserID.String(), true, nil
+		}
+		if err != nil {
+			st := authError(err)
+			if status.Code(st) == codes.Internal {
+				logging.FromContext(ctx).Error().Err(err).Str("method", info.FullMethod).Msg("grpc auth failure")
+			}
+			return nil, st
+		}
+		if rotate {
+			_ = grpc.SetHeader(ctx, metadata.Pairs(UserTokenHeader, users.Signer.Sign(userID)))
+		}
+		logging.SetUserID(ctx, userID)
+		return handler(context.WithValue(ctx, userCtxKey{}, userID), req)
+	}
+}
+
+// Limits are rate limiters of calls, they are shared with REST routes of the same kind,
+// so client can not bypass REST limits by grpc. Nil limiter does not limit calls
+type Limits struct {
+	Create   *middlewares.Limiter // Shorten
+	Batch    *middlewares.Limiter // ShortenBatch
+	Redirect *middlewares.Limiter // Resolve
+	Proxies  *middlewares.TrustedProxies
+}
+
+func (l Limits) limiter(method string) *middlewares.Limiter {
+	switch method {
+	case pb.Shortener_Shorten_FullMethodName:
+		return l.Create
+	case pb.Shortener_ShortenBatch_FullMethodName:
+		return l.Batch
+	case pb.Shortener_Resolve_FullMethodName:
+		return l.Redirect
+	}
+	return nil
+}
+
+// RateLimitInterceptor reject calls over limit with RESOURCE_EXHAUSTED and "retry-after" header in seconds.
+// Client is identified the same as by REST limiter: user of old enough token or peer address.
+// Headers of ip are accepted only from trusted proxies
+func RateLimitInterceptor(users *controllers.URLController, limits Limits) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		l := limits.limiter(info.FullMethod)
+		if l == nil {
+			return handler(ctx, req)
+		}
+		if _, enabled := l.Limit(); !enabled {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		peerAddr := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			peerAddr = p.Addr.String()
+		}
+		ip := limits.Proxies.ClientIP(peerAddr, first(md, "x-real-ip"), strings.Join(md.Get("x-forwarded-for"), ","))
+		withAPIKey := len(first(md, "authorization")) > 0
+		ok, _, retryAfter, _ := l.Allow(users.ClientKey(withAPIKey, first(md, UserTokenHeader), ip))
+		if !ok {
+			seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// metadataCarrier let propagator read traceparent from incoming metadata
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	values := metadata.MD(m).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (m metadataCarrier) Set(key string, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// TracingInterceptor start server span for every call, trace context of caller is taken from
+// "traceparent" metadata
+func TracingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+		}
+		ctx, span := tracing.Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("rpc.method", info.FullMethod)))
+		res, err = handler(ctx, req)
+		span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+		tracing.End(span, err)
+		return res, err
+	}
+}
+
+// LoggingInterceptor write one line for every call, trace id is added when call is traced.
+// Call gets request logger with method and trace id, the same as http request, see logging.FromContext
+func LoggingInterceptor(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		callLogger := logger.With().Str("method", info.FullMethod)
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			callLogger = callLogger.Str("trace_id", spanContext.TraceID().String())
+		}
+		ctx = logging.NewContext(ctx, callLogger.Logger())
+		res, err := handler(ctx, req)
+
+		event := logger.Info()
+		if status.Code(err) == codes.Internal || status.Code(err) == codes.Unknown {
+			event = logger.Error()
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			event = event.Str("peer", p.Addr.String())
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			event = event.Str("trace_id", spanContext.TraceID().String())
+		}
+		event.Str("method", info.FullMethod).
+			Str("code", status.Code(err).String()).
+			Dur("duration", time.Since(start)).
+			Err(err).
+			Msg("grpc call")
+		return res, err
+	}
+}
+
+// authError convert identification error to status, the same as controllers authError
+func authError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrScope):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, stores.ErrUserBlocked):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, auth.ErrNoToken), errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrExpiredToken):
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return status.Error(codes.Internal, "storage failure")
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,271 @@
+// Package grpcserver contain gRPC api, it uses the same store and user identification as REST handlers
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Aligator77/go_practice/internal/controllers"
+	"github.com/Aligator77/go_practice/internal/helpers"
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/metrics"
+	"github.com/Aligator77/go_practice/internal/models"
+	"github.com/Aligator77/go_practice/internal/pb"
+	"github.com/Aligator77/go_practice/internal/stores"
+)
+
+// ShortenerServer implement pb.ShortenerServer, user of call is put to context by AuthInterceptor
+type ShortenerServer struct {
+	pb.UnimplementedShortenerServer
+
+	URLStore      *stores.URLStore
+	BatchMaxItems int
+}
+
+// New create grpc server with tracing, logging, rate limit and auth interceptors, users are identified
+// by urlController. Limits are checked before auth, so rejected calls do not create users
+func New(urlController *controllers.URLController, limits Limits, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(
+		TracingInterceptor(),
+		LoggingInterceptor(urlController.URLStore.Logger),
+		RateLimitInterceptor(urlController, limits),
+		AuthInterceptor(urlController),
+	))
+	s := grpc.NewServer(opts...)
+	pb.RegisterShortenerServer(s, &ShortenerServer{
+		URLStore:      urlController.URLStore,
+		BatchMaxItems: urlController.BatchMaxItems,
+	})
+	return s
+}
+
+func (s *ShortenerServer) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	userID := UserFromContext(ctx)
+	if err := s.URLStore.ValidateDestination(ctx, req.GetUrl()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	existRedirect, _ := s.URLStore.GetRedirectByURL(ctx, req.GetUrl())
+	if len(existRedirect.URL) > 0 {
+		return &pb.ShortenResponse{ShortUrl: s.URLStore.MakeFullURL(existRedirect.Redirect), Existed: true}, nil
+	}
+
+	allowed, unlock, err := s.URLStore.ReserveLinks(ctx, userID, 1)
+	if err != nil {
+		return nil, s.storageError(ctx, err)
+	}
+	defer unlock()
+	if allowed < 1 {
+		return nil, status.Error(codes.ResourceExhausted, stores.ErrQuotaExceeded.Error())
+	}
+
+	redirect := newRedirect(req.GetUrl(), userID)
+	if _, err := s.URLStore.NewRedirect(ctx, redirect); err != nil {
+		return nil, s.storageError(ctx, err)
+	}
+	return &pb.ShortenResponse{ShortUrl: s.URLStore.MakeFullURL(redirect.Redirect)}, nil
+}
+
+func (s *ShortenerServer) ShortenBatch(ctx context.Context, req *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	userID := UserFromContext(ctx)
+	items := req.GetItems()
+	if len(items) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "batch is empty")
+	}
+	if s.BatchMaxItems > 0 && len(items) > s.BatchMaxItems {
+		return nil, status.Errorf(codes.InvalidArgument, "batch can contain at most %d items", s.BatchMaxItems)
+	}
+	correlationIDs := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		if _, ok := correlationIDs[item.GetCorrelationId()]; ok || len(item.GetCorrelationId()) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "correlation_id %q is empty or duplicated", item.GetCorrelationId())
+		}
+		correlationIDs[item.GetCorrelationId()] = struct{}{}
+	}
+
+	results := make([]*pb.BatchResult, 0, len(items))
+	// created keep index of result for every new link, so links over quota can be reported as failed
+	var redirects []*models.Redirect
+	var created []int
+	batchURLs := make(map[string]string, len(items))
+	for _, item := range items {
+		result := &pb.BatchResult{CorrelationId: item.GetCorrelationId()}
+		results = append(results, result)
+
+		if err := s.URLStore.ValidateDestination(ctx, item.GetOriginalUrl()); err != nil {
+			result.Error = "invalid original_url: " + err.Error()
+			continue
+		}
+		canonicalURL := s.URLStore.CanonicalURL(item.GetOriginalUrl())
+		if slug, ok := batchURLs[canonicalURL]; ok {
+			result.ShortUrl = s.URLStore.MakeFullURL(slug)
+			continue
+		}
+		existRedirect, _ := s.URLStore.GetRedirectByURL(ctx, item.GetOriginalUrl())
+		if len(existRedirect.URL) > 0 {
+			result.ShortUrl = s.URLStore.MakeFullURL(existRedirect.Redirect)
+			continue
+		}
+
+		redirect := newRedirect(item.GetOriginalUrl(), userID)
+		redirect.CanonicalURL = canonicalURL
+		batchURLs[canonicalURL] = redirect.Redirect
+		result.ShortUrl = s.URLStore.MakeFullURL(redirect.Redirect)
+		redirects = append(redirects, &redirect)
+		created = append(created, len(results)-1)
+	}
+
+	if len(redirects) > 0 {
+		allowed, unlock, err := s.URLStore.ReserveLinks(ctx, userID, len(redirects))
+		if err != nil {
+			return nil, s.storageError(ctx, err)
+		}
+		defer unlock()
+		for _, i := range created[allowed:] {
+			results[i].ShortUrl = ""
+			results[i].Error = stores.ErrQuotaExceeded.Error()
+		}
+		if _, err := s.URLStore.NewRedirectsBatch(ctx, redirects[:allowed]); err != nil {
+			return nil, s.storageError(ctx, err)
+		}
+	}
+	return &pb.ShortenBatchResponse{Items: results}, nil
+}
+
+func (s *ShortenerServer) Resolve(ctx context.Context, req *pb.ResolveRequest) (*pb.ResolveResponse, error) {
+	if len(req.GetId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "short link is empty")
+	}
+	redirect, err := s.URLStore.GetRedirect(ctx, req.GetId())
+	if err != nil {
+		return nil, s.storageError(ctx, err)
+	}
+	if redirect.Redirect == "" {
+		metrics.Redirects.WithLabelValues(metrics.RedirectMiss).Inc()
+		return nil, status.Error(codes.NotFound, "short link not found")
+	}
+	if redirect.IsDelete == 1 || redirect.Expired() {
+		metrics.Redirects.WithLabelValues(metrics.RedirectGone).Inc()
+		// link exists, but can not be resolved any more, it is 410 of REST
+		return nil, status.Error(codes.FailedPrecondition, "short link is deleted or expired")
+	}
+	metrics.Redirects.WithLabelValues(metrics.RedirectHit).Inc()
+	return &pb.ResolveResponse{OriginalUrl: redirect.URL}, nil
+}
+
+func (s *ShortenerServer) ListUserURLs(ctx context.Context, req *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	filter, err := listFilter(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	redirects, next, err := s.URLStore.GetRedirectsByUserPage(ctx, UserFromContext(ctx), filter)
+	if errors.Is(err, stores.ErrInvalidCursor) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, s.storageError(ctx, err)
+	}
+
+	res := &pb.ListUserURLsResponse{NextCursor: next}
+	for _, redirect := range redirects {
+		res.Urls = append(res.Urls, &pb.UserURL{
+			ShortUrl:    s.URLStore.MakeFullURL(redirect.Redirect),
+			OriginalUrl: redirect.URL,
+		})
+	}
+	return res, nil
+}
+
+func (s *ShortenerServer) DeleteUserURLs(ctx context.Context, req *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
+	if len(req.GetIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "ids are empty")
+	}
+	// the same as REST handler, links are deleted in background
+	s.URLStore.DeleteRedirectAsync(ctx, UserFromContext(ctx), req.GetIds())
+	return &pb.DeleteUserURLsResponse{}, nil
+}
+
+func (s *ShortenerServer) Stats(ctx context.Context, _ *pb.StatsRequest) (*pb.StatsResponse, error) {
+	userID := UserFromContext(ctx)
+	quota, err := s.URLStore.GetUserQuota(ctx, userID)
+	if err != nil {
+		return nil, s.storageError(ctx, err)
+	}
+	usage, err := s.URLStore.GetQuotaUsage(ctx, userID)
+	if err != nil {
+		return nil, s.storageError(ctx, err)
+	}
+	return &pb.StatsResponse{
+		MaxLiveLinks:  int64(quota.MaxLiveLinks),
+		MaxDailyLinks: int64(quota.MaxDailyLinks),
+		LiveLinks:     int64(usage.LiveLinks),
+		DailyLinks:    int64(usage.DailyLinks),
+		DailyResetAt:  stores.QuotaDayStart(time.Now()).Add(24 * time.Hour).Format(time.RFC3339),
+	}, nil
+}
+
+func newRedirect(link string, userID string) models.Redirect {
+	newUUID, _ := uuid.NewV7()
+	return models.Redirect{
+		ID:         newUUID.String(),
+		IsDelete:   0,
+		URL:        link,
+		Redirect:   helpers.GenerateRandomURL(10),
+		DateCreate: time.Now().String(),
+		DateUpdate: time.Now().String(),
+		User:       userID,
+	}
+}
+
+// listFilter check listing request the same way as query of REST listing
+func listFilter(req *pb.ListUserURLsRequest) (filter models.URLListFilter, err error) {
+	filter = models.URLListFilter{
+		Status: models.URLStatusAll,
+		Sort:   models.SortAsc,
+		Limit:  models.URLListDefaultLimit,
+		Query:  req.GetQuery(),
+		Cursor: req.GetCursor(),
+	}
+	if req.GetLimit() != 0 {
+		if req.GetLimit() < 1 || req.GetLimit() > models.URLListMaxLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", models.URLListMaxLimit)
+		}
+		filter.Limit = int(req.GetLimit())
+	}
+	if s := req.GetStatus(); len(s) > 0 {
+		if s != models.URLStatusAll && s != models.URLStatusLive && s != models.URLStatusDeleted {
+			return filter, errors.New("status must be one of all, live, deleted")
+		}
+		filter.Status = s
+	}
+	if order := req.GetSort(); len(order) > 0 {
+		if order != models.SortAsc && order != models.SortDesc {
+			return filter, errors.New("sort must be asc or desc")
+		}
+		filter.Sort = order
+	}
+	if from := req.GetCreatedFrom(); len(from) > 0 {
+		if filter.CreatedFrom, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, errors.New("created_from must be RFC3339 date")
+		}
+	}
+	if to := req.GetCreatedTo(); len(to) > 0 {
+		if filter.CreatedTo, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, errors.New("created_to must be RFC3339 date")
+		}
+	}
+	return filter, nil
+}
+
+// storageError hide details of store failure from client, the same as server.ErrStorage
+func (s *ShortenerServer) storageError(ctx context.Context, err error) error {
+	logging.FromContext(ctx).Error().Err(err).Msg("grpc storage failure")
+	return status.Error(codes.Internal, "storage failure")
+}
@@ -0,0 +1,179 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/Aligator77/go_practice/internal/config"
+	"github.com/Aligator77/go_practice/internal/controllers"
+	"github.com/Aligator77/go_practice/internal/middlewares"
+	"github.com/Aligator77/go_practice/internal/models"
+	"github.com/Aligator77/go_practice/internal/pb"
+	"github.com/Aligator77/go_practice/internal/stores"
+)
+
+func newTestClient(t *testing.T, limits Limits) (pb.ShortenerClient, *stores.URLStore) {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+	db := &config.ConnectionPool{DisableDBStore: "1"}
+	urlServices := stores.NewURLService(db, logger, "http://localhost", "", "1")
+	urlController := controllers.NewURLController(urlServices)
+
+	listener := bufconn.Listen(1 << 20)
+	s := New(urlController, limits)
+	go func() {
+		_ = s.Serve(listener)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewShortenerClient(conn), urlServices
+}
+
+func TestShortenerServer(t *testing.T) {
+	client, urlServices := newTestClient(t, Limits{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var header metadata.MD
+	created, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "http://example.com/grpc"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.False(t, created.GetExisted())
+	token := header.Get(UserTokenHeader)
+	require.Len(t, token, 1, "Новый пользователь должен получить токен")
+	userCtx := metadata.AppendToOutgoingContext(ctx, UserTokenHeader, token[0])
+
+	again, err := client.Shorten(userCtx, &pb.ShortenRequest{Url: "http://example.com/grpc"})
+	require.NoError(t, err)
+	assert.True(t, again.GetExisted(), "Повторная ссылка должна быть найдена")
+	assert.Equal(t, created.GetShortUrl(), again.GetShortUrl())
+
+	_, err = client.Shorten(userCtx, &pb.ShortenRequest{Url: "ftp://example.com"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	slug := created.GetShortUrl()[len("http://localhost/"):]
+	resolved, err := client.Resolve(ctx, &pb.ResolveRequest{Id: slug})
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/grpc", resolved.GetOriginalUrl())
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = urlServices.SetRedirectDeleted(context.Background(), slug, true)
+	require.NoError(t, err)
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: slug})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "Удаленная ссылка отличается от несуществующей")
+	_, err = urlServices.SetRedirectDeleted(context.Background(), slug, false)
+	require.NoError(t, err)
+
+	batch, err := client.ShortenBatch(userCtx, &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "http://example.com/batch"},
+		{CorrelationId: "2", OriginalUrl: "not url"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, batch.GetItems(), 2)
+	assert.NotEmpty(t, batch.GetItems()[0].GetShortUrl())
+	assert.NotEmpty(t, batch.GetItems()[1].GetError(), "Невалидная ссылка должна вернуть ошибку")
+
+	list, err := client.ListUserURLs(userCtx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.GetUrls(), 2)
+	_, err = client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Список без токена недоступен")
+	_, err = client.ListUserURLs(metadata.AppendToOutgoingContext(ctx, UserTokenHeader, "forged"), &pb.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	stats, err := client.Stats(userCtx, &pb.StatsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.GetLiveLinks())
+
+	redirect, _ := urlServices.GetRedirect(context.Background(), slug)
+	require.NoError(t, urlServices.BlockUser(context.Background(), models.BlockedUser{UserID: redirect.User}))
+	_, err = client.Shorten(userCtx, &pb.ShortenRequest{Url: "http://example.com/blocked"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "Заблокированный пользователь не создает ссылки")
+}
+
+func TestDeleteUserURLsOwnership(t *testing.T) {
+	client, urlServices := newTestClient(t, Limits{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	shorten := func(link string) (string, context.Context) {
+		var header metadata.MD
+		created, err := client.Shorten(ctx, &pb.ShortenRequest{Url: link}, grpc.Header(&header))
+		require.NoError(t, err)
+		token := header.Get(UserTokenHeader)
+		require.Len(t, token, 1)
+		return created.GetShortUrl()[len("http://localhost/"):], metadata.AppendToOutgoingContext(ctx, UserTokenHeader, token[0])
+	}
+	slugA, ctxA := shorten("http://example.com/owner-a")
+	slugB, ctxB := shorten("http://example.com/owner-b")
+
+	_, err := client.DeleteUserURLs(ctx, &pb.DeleteUserURLsRequest{Ids: []string{slugA}})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Удаление без токена не создает нового пользователя")
+
+	_, err = client.DeleteUserURLs(ctxB, &pb.DeleteUserURLsRequest{Ids: []string{slugA, slugB}})
+	require.NoError(t, err)
+	require.NoError(t, urlServices.WaitBackground(ctx))
+
+	redirectA, err := urlServices.GetRedirect(context.Background(), slugA)
+	require.NoError(t, err)
+	assert.Equal(t, 0, redirectA.IsDelete, "Пользователь B не может удалить ссылку пользователя A")
+	redirectB, err := urlServices.GetRedirect(context.Background(), slugB)
+	require.NoError(t, err)
+	assert.Equal(t, 1, redirectB.IsDelete, "Своя ссылка должна быть удалена")
+
+	_, err = client.DeleteUserURLs(ctxA, &pb.DeleteUserURLsRequest{Ids: []string{slugA}})
+	require.NoError(t, err)
+	require.NoError(t, urlServices.WaitBackground(ctx))
+	redirectA, _ = urlServices.GetRedirect(context.Background(), slugA)
+	assert.Equal(t, 1, redirectA.IsDelete)
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	limits := Limits{
+		Create:   middlewares.NewLimiter(middlewares.RateLimit{Rate: 0.01, Burst: 1}, time.Minute, 0),
+		Batch:    middlewares.NewLimiter(middlewares.RateLimit{Rate: 0.01, Burst: 1}, time.Minute, 0),
+		Redirect: middlewares.NewLimiter(middlewares.RateLimit{Rate: 0.01, Burst: 1}, time.Minute, 0),
+	}
+	client, _ := newTestClient(t, limits)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var header metadata.MD
+	_, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "http://example.com/limit-1"}, grpc.Header(&header))
+	require.NoError(t, err)
+	userCtx := metadata.AppendToOutgoingContext(ctx, UserTokenHeader, header.Get(UserTokenHeader)[0])
+
+	header = nil
+	_, err = client.Shorten(userCtx, &pb.ShortenRequest{Url: "http://example.com/limit-2"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "Новый токен не дает нового лимита")
+	assert.NotEmpty(t, header.Get("retry-after"))
+
+	_, err = client.ShortenBatch(ctx, &pb.ShortenBatchRequest{Items: []*pb.BatchItem{{CorrelationId: "1", OriginalUrl: "http://example.com/limit-3"}}})
+	require.NoError(t, err)
+	_, err = client.ShortenBatch(metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", "198.51.100.7"),
+		&pb.ShortenBatchRequest{Items: []*pb.BatchItem{{CorrelationId: "1", OriginalUrl: "http://example.com/limit-4"}}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "Заголовок ip от недоверенного клиента не учитывается")
+
+	limits.Create.Update(middlewares.RateLimit{Rate: 0.01, Burst: 1}, false)
+	_, err = client.Shorten(userCtx, &pb.ShortenRequest{Url: "http://example.com/limit-5"})
+	assert.NoError(t, err, "Выключенный лимит пропускает вызовы")
+}
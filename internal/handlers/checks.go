@@ -0,0 +1,57 @@
+// Package handlers contain health check handlers
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileWritable check file can be opened for writing, nothing is written. When file does not
+// exist yet, its directory is checked by creating temporary file
+func FileWritable(path string) Check {
+	return func(context.Context) error {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if errors.Is(err, os.ErrNotExist) {
+			f, err = os.CreateTemp(filepath.Dir(path), ".health-*")
+			if err == nil {
+				defer os.Remove(f.Name())
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// DiskSpace check there are at least minFree bytes available on disk of path
+func DiskSpace(path string, minFree uint64) Check {
+	return func(context.Context) error {
+		free, err := diskFree(filepath.Dir(path))
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d bytes free, need at least %d", free, minFree)
+		}
+		return nil
+	}
+}
+
+// Background check the oldest background job is not running longer than maxAge, so stuck
+// workers are noticed
+func Background(oldest func() time.Duration, maxAge time.Duration) Check {
+	return func(context.Context) error {
+		if age := oldest(); age > maxAge {
+			return fmt.Errorf("background job is running for %s", age.Round(time.Second))
+		}
+		return nil
+	}
+}
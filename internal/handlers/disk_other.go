@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package handlers
+
+import "errors"
+
+// diskFree is not supported, disk space check always passes
+func diskFree(string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
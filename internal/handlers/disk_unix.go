@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package handlers
+
+import "syscall"
+
+// diskFree return bytes available to not root user on disk of dir
+func diskFree(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
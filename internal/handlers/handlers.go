@@ -1,19 +1,26 @@
-// Package handlers contain health check handler
+// Package handlers contain health check handlers
 package handlers
 
 import (
 	"net/http"
+
+	"github.com/go-chi/render"
 )
 
-func HealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	// пока установим ответ-заглушку, без проверки ошибок
-	_, _ = w.Write([]byte(`
-      {
-        "response": {
-          "text": "OK"
-        },
-        "version": "1.0"
-      }
-    `))
+// HealthResponse is answer of /health
+type HealthResponse struct {
+	Response struct {
+		Text string `json:"text"`
+	} `json:"response"`
+	Version string `json:"version"`
+}
+
+// HealthCheck answer that process is running, it does not check dependencies, /readyz does it
+func HealthCheck(version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var res HealthResponse
+		res.Response.Text = "OK"
+		res.Version = version
+		render.JSON(w, r, res)
+	}
 }
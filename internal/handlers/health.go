@@ -0,0 +1,153 @@
+// Package handlers contain health check handlers
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+// statuses of probe and its checks
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check return error when dependency is not healthy, it must stop on ctx deadline
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// CheckResult is result of one check
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ProbeResponse is answer of /livez and /readyz, status is ok only when all checks are ok
+type ProbeResponse struct {
+	Status  string        `json:"status"`
+	Version string        `json:"version"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+// Probes keep liveness and readiness checks. Liveness checks tell the process is not stuck and
+// must be restarted, readiness checks tell it can serve requests. Readiness fails after Drain,
+// so load balancer stops sending requests before servers are stopped
+type Probes struct {
+	version string
+	timeout time.Duration
+
+	mu       sync.Mutex
+	live     []namedCheck
+	ready    []namedCheck
+	draining atomic.Bool
+}
+
+// NewProbes create probes, every check gets timeout
+func NewProbes(version string, timeout time.Duration) *Probes {
+	return &Probes{version: version, timeout: timeout}
+}
+
+// AddLive add liveness check
+func (p *Probes) AddLive(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.live = append(p.live, namedCheck{name: name, check: check})
+}
+
+// AddReady add readiness check
+func (p *Probes) AddReady(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ready = append(p.ready, namedCheck{name: name, check: check})
+}
+
+// Drain make readiness fail and wait delay, so load balancer notices it before servers are stopped.
+// It is shutdown step
+func (p *Probes) Drain(ctx context.Context, delay time.Duration) error {
+	p.draining.Store(true)
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LiveHandler run liveness checks
+func (p *Probes) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	checks := append([]namedCheck(nil), p.live...)
+	p.mu.Unlock()
+	p.respond(w, r, p.run(r.Context(), checks))
+}
+
+// ReadyHandler run readiness checks, during shutdown "shutdown" check fails
+func (p *Probes) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	checks := append([]namedCheck(nil), p.ready...)
+	p.mu.Unlock()
+	results := p.run(r.Context(), checks)
+	if p.draining.Load() {
+		results = append(results, CheckResult{Name: "shutdown", Status: StatusFail, Error: "service is shutting down"})
+	}
+	p.respond(w, r, results)
+}
+
+// run start all checks at once, so slow dependency does not delay others
+func (p *Probes) run(ctx context.Context, checks []namedCheck) []CheckResult {
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, p.timeout)
+			defer cancel()
+			start := time.Now()
+			err := c.check(checkCtx)
+			results[i] = CheckResult{
+				Name:      c.name,
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				results[i].Status = StatusFail
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (p *Probes) respond(w http.ResponseWriter, r *http.Request, results []CheckResult) {
+	res := ProbeResponse{Status: StatusOK, Version: p.version, Checks: results}
+	if res.Checks == nil {
+		res.Checks = []CheckResult{}
+	}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			res.Status = StatusFail
+		}
+	}
+	if res.Status != StatusOK {
+		render.Status(r, http.StatusServiceUnavailable)
+	}
+	render.JSON(w, r, res)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, handler http.HandlerFunc) (int, ProbeResponse) {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var res ProbeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	return w.Code, res
+}
+
+func TestProbes(t *testing.T) {
+	probes := NewProbes("1.2.3", 50*time.Millisecond)
+	probes.AddLive("worker", func(context.Context) error { return nil })
+	probes.AddReady("db", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	probes.AddReady("file_store", func(context.Context) error { return nil })
+
+	code, res := probe(t, probes.LiveHandler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, res.Status)
+	assert.Equal(t, "1.2.3", res.Version)
+
+	code, res = probe(t, probes.ReadyHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "Зависшая проверка должна завершаться по таймауту с ошибкой")
+	assert.Equal(t, StatusFail, res.Status)
+	require.Len(t, res.Checks, 2)
+	assert.Equal(t, "db", res.Checks[0].Name)
+	assert.Equal(t, StatusFail, res.Checks[0].Status)
+	assert.Contains(t, res.Checks[0].Error, "deadline")
+	assert.GreaterOrEqual(t, res.Checks[0].LatencyMS, float64(50))
+	assert.Equal(t, StatusOK, res.Checks[1].Status)
+}
+
+func TestProbesDrain(t *testing.T) {
+	probes := NewProbes("1.2.3", time.Second)
+	code, _ := probe(t, probes.ReadyHandler)
+	assert.Equal(t, http.StatusOK, code)
+
+	require.NoError(t, probes.Drain(context.Background(), 0))
+	code, res := probe(t, probes.ReadyHandler)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "Во время остановки готовность должна падать")
+	require.Len(t, res.Checks, 1)
+	assert.Equal(t, "shutdown", res.Checks[0].Name)
+
+	code, _ = probe(t, probes.LiveHandler)
+	assert.Equal(t, http.StatusOK, code, "Живость не зависит от остановки")
+}
+
+func TestChecks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+	ctx := context.Background()
+
+	assert.NoError(t, FileWritable(path)(ctx), "Отсутствующий файл проверяется по каталогу")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	assert.NoError(t, FileWritable(path)(ctx))
+	assert.Error(t, FileWritable(filepath.Join(dir, "missing", "store.json"))(ctx))
+
+	assert.NoError(t, DiskSpace(path, 1)(ctx))
+	assert.Error(t, DiskSpace(path, 1<<62)(ctx))
+
+	age := time.Duration(0)
+	check := Background(func() time.Duration { return age }, time.Minute)
+	assert.NoError(t, check(ctx))
+	age = 2 * time.Minute
+	assert.Error(t, check(ctx), "Зависшая фоновая задача должна ломать живость")
+}
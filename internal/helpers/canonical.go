@@ -0,0 +1,211 @@
+// Package helpers contain functions for simple work
+package helpers
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// trackingParams are removed from query when CanonicalOptions.StripTracking is set,
+// params with utm_ prefix are removed too
+var trackingParams = map[string]struct{}{
+	"fbclid":    {},
+	"gclid":     {},
+	"yclid":     {},
+	"msclkid":   {},
+	"_openstat": {},
+}
+
+// CanonicalOptions switch optional steps of CanonicalizeURL
+type CanonicalOptions struct {
+	SortQuery     bool // sort query params by name
+	StripTracking bool // remove utm_* and click id params
+}
+
+// CanonicalizeURL function for bringing url to one form before deduplication.
+// Scheme and host are lowercased, default port is removed, IDN host is converted to punycode,
+// escapes of path are normalized. Fragment is kept as is.
+//
+// Example:
+//
+// canonical, err := helpers.CanonicalizeURL("HTTP://Example.com:80/a?b=1&a=2", helpers.CanonicalOptions{SortQuery: true})
+//
+// canonical == "http://example.com/a?a=2&b=1"
+func CanonicalizeURL(link string, opts CanonicalOptions) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	if len(u.Host) > 0 {
+		host, err := canonicalHost(u.Hostname())
+		if err != nil {
+			return "", err
+		}
+		port := u.Port()
+		if port == defaultPorts[u.Scheme] {
+			port = ""
+		}
+		if len(port) > 0 {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		u.Host = host
+	}
+
+	escapedPath := normalizeEscapes(u.EscapedPath())
+	if len(escapedPath) == 0 && len(u.Host) > 0 {
+		escapedPath = "/"
+	}
+	escapedPath = removeDotSegments(escapedPath)
+	if u.Path, err = url.PathUnescape(escapedPath); err != nil {
+		return "", err
+	}
+	u.RawPath = escapedPath
+
+	u.RawQuery = canonicalQuery(u.RawQuery, opts)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func canonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+// normalizeEscapes decode escaped unreserved symbols and uppercase hex digits of other escapes
+func normalizeEscapes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// removeDotSegments resolve "." and ".." segments by RFC 3986 section 5.2.4.
+// Empty segments and trailing slash are kept, they can change resource on server
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+	// every output segment keeps its leading slash
+	var out []string
+	pop := func() {
+		if len(out) > 0 {
+			out = out[:len(out)-1]
+		}
+	}
+	for in := p; len(in) > 0; {
+		switch {
+		case strings.HasPrefix(in, "../"):
+			in = in[3:]
+		case strings.HasPrefix(in, "./"), strings.HasPrefix(in, "/./"):
+			in = in[2:]
+		case in == "/.":
+			in = "/"
+		case strings.HasPrefix(in, "/../"):
+			in = in[3:]
+			pop()
+		case in == "/..":
+			in = "/"
+			pop()
+		case in == "." || in == "..":
+			in = ""
+		default:
+			start := 0
+			if in[0] == '/' {
+				start = 1
+			}
+			end := len(in)
+			if i := strings.IndexByte(in[start:], '/'); i >= 0 {
+				end = start + i
+			}
+			out = append(out, in[:end])
+			in = in[end:]
+		}
+	}
+	return strings.Join(out, "")
+}
+
+func canonicalQuery(rawQuery string, opts CanonicalOptions) string {
+	if len(rawQuery) == 0 {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	result := params[:0]
+	for _, param := range params {
+		if len(param) == 0 {
+			continue
+		}
+		if opts.StripTracking && isTrackingParam(param) {
+			continue
+		}
+		result = append(result, normalizeEscapes(param))
+	}
+	if opts.SortQuery {
+		// values of one param keep their order
+		sort.SliceStable(result, func(i, j int) bool {
+			return queryKey(result[i]) < queryKey(result[j])
+		})
+	}
+	return strings.Join(result, "&")
+}
+
+func isTrackingParam(param string) bool {
+	key := strings.ToLower(queryKey(param))
+	if strings.HasPrefix(key, "utm_") {
+		return true
+	}
+	_, ok := trackingParams[key]
+	return ok
+}
+
+func queryKey(param string) string {
+	key, _, _ := strings.Cut(param, "=")
+	return key
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
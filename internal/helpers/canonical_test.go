@@ -0,0 +1,40 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalizeURL(t *testing.T) {
+	testCases := []struct {
+		url      string
+		opts     CanonicalOptions
+		expected string
+		testName string
+	}{
+		{url: "HTTP://Example.com:80/a?b=1&a=2", opts: CanonicalOptions{SortQuery: true}, expected: "http://example.com/a?a=2&b=1", testName: "scheme host port sort"},
+		{url: "http://example.com/a?a=2&b=1", opts: CanonicalOptions{SortQuery: true}, expected: "http://example.com/a?a=2&b=1", testName: "already canonical"},
+		{url: "https://example.com:443", expected: "https://example.com/", testName: "default https port and empty path"},
+		{url: "https://example.com:8443/", expected: "https://example.com:8443/", testName: "custom port"},
+		{url: "http://пример.рф/путь", expected: "http://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C", testName: "idn host"},
+		{url: "http://example.com/%7euser/%2fa%2Fb", expected: "http://example.com/~user/%2Fa%2Fb", testName: "path escapes"},
+		{url: "http://example.com/a/./b/../c/", expected: "http://example.com/a/c/", testName: "dot segments"},
+		{url: "http://example.com/a//b", expected: "http://example.com/a//b", testName: "empty segment"},
+		{url: "http://example.com/a/b/", expected: "http://example.com/a/b/", testName: "trailing slash"},
+		{url: "http://example.com/a//./b/../c/", expected: "http://example.com/a//c/", testName: "dot segments keep empty segment"},
+		{url: "http://example.com/a/b/..", expected: "http://example.com/a/", testName: "dot segment at end"},
+		{url: "http://example.com/../a/.", expected: "http://example.com/a/", testName: "dot segments above root"},
+		{url: "http://example.com/a.b/c..d", expected: "http://example.com/a.b/c..d", testName: "dots inside segments"},
+		{url: "http://example.com/?b=1&utm_source=x&a=2&fbclid=y", opts: CanonicalOptions{StripTracking: true}, expected: "http://example.com/?b=1&a=2", testName: "strip tracking"},
+		{url: "http://example.com/?b=1&utm_source=x", expected: "http://example.com/?b=1&utm_source=x", testName: "keep tracking"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			res, err := CanonicalizeURL(tc.url, tc.opts)
+			assert.NoError(t, err, "Ошибка канонизации")
+			assert.Equal(t, tc.expected, res, "Каноническая форма не совпадает")
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package helpers contain functions for simple work
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+
+	QRMinSize   = 64
+	QRMaxSize   = 2048
+	QRMaxMargin = 16
+)
+
+var (
+	ErrQRSize   = fmt.Errorf("qr size must be between %d and %d", QRMinSize, QRMaxSize)
+	ErrQRMargin = fmt.Errorf("qr margin must be between 0 and %d", QRMaxMargin)
+	ErrQRLevel  = errors.New("qr level must be one of L, M, Q, H")
+	ErrQRFormat = errors.New("qr format must be png or svg")
+	// ErrQRTooSmall is returned when png has less pixels than modules of code with margin
+	ErrQRTooSmall = errors.New("qr size is too small for this link, increase size or decrease margin")
+)
+
+// QROptions describe how GenerateQR draws the code
+type QROptions struct {
+	Size   int    // width and height of the image in pixels
+	Margin int    // quiet zone around the code in modules
+	Level  string // error correction level: L, M, Q or H
+	Format string // png or svg
+}
+
+// DefaultQROptions return options used when request has no query params
+func DefaultQROptions() QROptions {
+	return QROptions{
+		Size:   256,
+		Margin: 4,
+		Level:  "M",
+		Format: QRFormatPNG,
+	}
+}
+
+// Validate check options bounds before generation
+func (o QROptions) Validate() error {
+	if o.Size < QRMinSize || o.Size > QRMaxSize {
+		return ErrQRSize
+	}
+	if o.Margin < 0 || o.Margin > QRMaxMargin {
+		return ErrQRMargin
+	}
+	if _, err := qrLevel(o.Level); err != nil {
+		return err
+	}
+	if o.Format != QRFormatPNG && o.Format != QRFormatSVG {
+		return ErrQRFormat
+	}
+	return nil
+}
+
+// ContentType return mime type of generated image
+func (o QROptions) ContentType() string {
+	if o.Format == QRFormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// GenerateQR function for encode content to qr code image in png or svg format
+//
+// Example:
+//
+// img, err := helpers.GenerateQR("http://localhost:8080/EwHXdJfB", helpers.DefaultQROptions())
+func GenerateQR(content string, opts QROptions) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	level, _ := qrLevel(opts.Level)
+
+	q, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, err
+	}
+	// quiet zone is drawn by us, so margin can be changed
+	q.DisableBorder = true
+	bitmap := q.Bitmap()
+
+	if opts.Format == QRFormatSVG {
+		return qrSVG(bitmap, opts), nil
+	}
+	return qrPNG(bitmap, opts)
+}
+
+func qrLevel(level string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToUpper(level) {
+	case "L":
+		return qrcode.Low, nil
+	case "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	}
+	return qrcode.Medium, ErrQRLevel
+}
+
+func qrPNG(bitmap [][]bool, opts QROptions) ([]byte, error) {
+	modules := len(bitmap) + 2*opts.Margin
+	// module smaller than pixel is lost, so such code can not be read
+	if opts.Size < modules {
+		return nil, fmt.Errorf("%w: %d modules in %d pixels", ErrQRTooSmall, modules, opts.Size)
+	}
+	scale := opts.Size / modules
+	// center the code if size is not divisible by modules count
+	offset := (opts.Size - scale*modules) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{color.White, color.Black})
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			startX := offset + (x+opts.Margin)*scale
+			startY := offset + (y+opts.Margin)*scale
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(startX+dx, startY+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func qrSVG(bitmap [][]bool, opts QROptions) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes()
+}
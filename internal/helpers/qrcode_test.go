@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateQR(t *testing.T) {
+	content := "http://localhost:8080/EwHXdJfB"
+
+	t.Run("PNG", func(t *testing.T) {
+		opts := DefaultQROptions()
+		opts.Size = 300
+
+		data, err := GenerateQR(content, opts)
+		assert.NoError(t, err, "Ошибка генерации png")
+
+		img, err := png.Decode(bytes.NewReader(data))
+		assert.NoError(t, err, "Ошибка чтения png")
+		assert.Equal(t, 300, img.Bounds().Dx(), "Ширина не совпала")
+		assert.Equal(t, 300, img.Bounds().Dy(), "Высота не совпала")
+	})
+
+	t.Run("SVG", func(t *testing.T) {
+		opts := DefaultQROptions()
+		opts.Format = QRFormatSVG
+		opts.Margin = 0
+
+		data, err := GenerateQR(content, opts)
+		assert.NoError(t, err, "Ошибка генерации svg")
+		assert.True(t, strings.HasPrefix(string(data), "<svg"), "Ответ не svg")
+		assert.Equal(t, "image/svg+xml", opts.ContentType(), "Тип не совпал")
+	})
+
+	t.Run("long url in min size", func(t *testing.T) {
+		long := "http://localhost:8080/" + strings.Repeat("a", 500)
+		opts := QROptions{Size: QRMinSize, Margin: 4, Level: "H", Format: QRFormatPNG}
+		_, err := GenerateQR(long, opts)
+		assert.ErrorIs(t, err, ErrQRTooSmall, "Обрезанный код нельзя прочитать")
+
+		opts.Format = QRFormatSVG
+		_, err = GenerateQR(long, opts)
+		assert.NoError(t, err, "Svg масштабируется без потерь")
+
+		opts.Format, opts.Size = QRFormatPNG, QRMaxSize
+		data, err := GenerateQR(long, opts)
+		assert.NoError(t, err)
+		_, err = png.Decode(bytes.NewReader(data))
+		assert.NoError(t, err, "Ошибка чтения png")
+	})
+
+	invalidVariant := []struct {
+		name string
+		opts QROptions
+		err  error
+	}{
+		{"small size", QROptions{Size: 10, Margin: 4, Level: "M", Format: QRFormatPNG}, ErrQRSize},
+		{"big margin", QROptions{Size: 256, Margin: 100, Level: "M", Format: QRFormatPNG}, ErrQRMargin},
+		{"wrong level", QROptions{Size: 256, Margin: 4, Level: "X", Format: QRFormatPNG}, ErrQRLevel},
+		{"wrong format", QROptions{Size: 256, Margin: 4, Level: "H", Format: "gif"}, ErrQRFormat},
+	}
+	for _, c := range invalidVariant {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := GenerateQR(content, c.opts)
+			assert.ErrorIs(t, err, c.err, "Ошибка валидации не совпала")
+		})
+	}
+}
@@ -3,8 +3,27 @@ package helpers
 
 import (
 	"net/url"
+	"regexp"
+	"strings"
 )
 
+var aliasRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,64}$`)
+
+// reservedAliases are first path segments of service routes, such alias would shadow route
+// or could never be opened
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"ping":    {},
+	"health":  {},
+	"livez":   {},
+	"readyz":  {},
+	"docs":    {},
+	"openapi": {},
+	"metrics": {},
+	"debug":   {},
+	"admin":   {},
+}
+
 // ValidateURL function for validation url in string
 func ValidateURL(link string) (result bool, err error) {
 	_, err = url.ParseRequestURI(link)
@@ -14,3 +33,14 @@ func ValidateURL(link string) (result bool, err error) {
 
 	return true, nil
 }
+
+// ValidateAlias function for validation custom short link, it may contain latin letters, digits, "_" and "-"
+func ValidateAlias(alias string) bool {
+	return aliasRegexp.MatchString(alias) && !IsReservedAlias(alias)
+}
+
+// IsReservedAlias check alias is name of service route
+func IsReservedAlias(alias string) bool {
+	_, ok := reservedAliases[strings.ToLower(alias)]
+	return ok
+}
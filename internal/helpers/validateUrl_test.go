@@ -33,3 +33,24 @@ func TestURLGeneration(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateAlias(t *testing.T) {
+	aliasVariant := []struct {
+		alias string
+		valid bool
+	}{
+		{"promo-2025", true},
+		{"my_link", true},
+		{"ab", false},
+		{"with space", false},
+		{"qr/path", false},
+		{"api", false},
+		{"Health", false},
+		{"readyz", false},
+		{"openapi", false},
+		{"api-docs", true},
+	}
+	for _, c := range aliasVariant {
+		assert.Equal(t, c.valid, ValidateAlias(c.alias), "ValidateAlias Проверка не пройдена "+c.alias)
+	}
+}
@@ -0,0 +1,129 @@
+// Package lifecycle run servers of application and stop them in order on signal or failure
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// exitCodeForced is exit code, when shutdown is interrupted by second signal
+const exitCodeForced = 1
+
+type step struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// Manager keep running services and shutdown steps. Shutdown starts on SIGINT, SIGTERM or
+// failure of any service, steps run in order of registration and share one deadline.
+// SIGHUP calls reload functions and does not stop anything
+type Manager struct {
+	logger  zerolog.Logger
+	timeout time.Duration
+	steps   []step
+	reloads []func()
+
+	errc chan error
+	sigc chan os.Signal
+	exit func(code int)
+}
+
+func New(logger zerolog.Logger, timeout time.Duration) *Manager {
+	return &Manager{
+		logger:  logger,
+		timeout: timeout,
+		errc:    make(chan error, 1),
+		sigc:    make(chan os.Signal, 2),
+		exit:    os.Exit,
+	}
+}
+
+// Go run service in background, error of service starts shutdown. Service must return nil,
+// when it is stopped by shutdown step
+func (m *Manager) Go(name string, run func() error) {
+	go func() {
+		if err := run(); err != nil {
+			m.logger.Error().Err(err).Str("service", name).Msg("service failed")
+			select {
+			case m.errc <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// OnShutdown add shutdown step, steps run in order of registration
+func (m *Manager) OnShutdown(name string, stop func(ctx context.Context) error) {
+	m.steps = append(m.steps, step{name: name, stop: stop})
+}
+
+// OnReload add function called on SIGHUP, functions run in order of registration
+func (m *Manager) OnReload(reload func()) {
+	m.reloads = append(m.reloads, reload)
+}
+
+// Wait block until signal or service failure and run shutdown steps. Failed step does not stop
+// others, so db is closed even if requests are not finished. Second signal exits at once,
+// SIGHUP only reloads config. Errors of failed service and steps are returned
+func (m *Manager) Wait() error {
+	signal.Notify(m.sigc, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(m.sigc)
+
+	var result error
+	for waiting := true; waiting; {
+		select {
+		case sig := <-m.sigc:
+			if sig == syscall.SIGHUP {
+				m.logger.Info().Str("signal", sig.String()).Msg("received signal, reloading config")
+				for _, reload := range m.reloads {
+					reload()
+				}
+				continue
+			}
+			m.logger.Info().Str("signal", sig.String()).Msg("received signal, shutting down")
+		case err := <-m.errc:
+			m.logger.Error().Err(err).Msg("service failed, shutting down")
+			result = err
+		}
+		waiting = false
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-m.sigc:
+				if sig == syscall.SIGHUP {
+					m.logger.Warn().Msg("config is not reloaded during shutdown")
+					continue
+				}
+				m.logger.Warn().Str("signal", sig.String()).Msg("received second signal, exiting without shutdown")
+				m.exit(exitCodeForced)
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	for _, s := range m.steps {
+		start := time.Now()
+		err := s.stop(ctx)
+		if err != nil {
+			m.logger.Error().Err(err).Str("step", s.name).Dur("duration", time.Since(start)).Msg("shutdown step failed")
+			result = errors.Join(result, err)
+			continue
+		}
+		m.logger.Info().Str("step", s.name).Dur("duration", time.Since(start)).Msg("shutdown step done")
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	m := New(zerolog.Nop(), time.Second)
+	var order []string
+	for _, name := range []string{"servers", "deletes", "file", "db"} {
+		m.OnShutdown(name, func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok, "У шага остановки должен быть дедлайн")
+			order = append(order, name)
+			if name == "deletes" {
+				return errors.New("deletes are not finished")
+			}
+			return nil
+		})
+	}
+
+	m.sigc <- syscall.SIGTERM
+	err := m.Wait()
+	assert.EqualError(t, err, "deletes are not finished")
+	assert.Equal(t, []string{"servers", "deletes", "file", "db"}, order, "Ошибка шага не должна останавливать остальные")
+}
+
+func TestServiceFailure(t *testing.T) {
+	m := New(zerolog.Nop(), time.Second)
+	stopped := false
+	m.OnShutdown("servers", func(context.Context) error {
+		stopped = true
+		return nil
+	})
+	m.Go("http", func() error {
+		return errors.New("address already in use")
+	})
+	m.Go("grpc", func() error {
+		return nil
+	})
+
+	err := m.Wait()
+	assert.EqualError(t, err, "address already in use", "Ошибка сервиса должна завершать процесс с ошибкой")
+	assert.True(t, stopped)
+}
+
+func TestSecondSignal(t *testing.T) {
+	m := New(zerolog.Nop(), time.Second)
+	exited := make(chan int, 1)
+	m.exit = func(code int) {
+		exited <- code
+	}
+	m.OnShutdown("servers", func(ctx context.Context) error {
+		m.sigc <- syscall.SIGINT
+		select {
+		case code := <-exited:
+			exited <- code
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	m.sigc <- syscall.SIGTERM
+	_ = m.Wait()
+	select {
+	case code := <-exited:
+		assert.Equal(t, exitCodeForced, code, "Второй сигнал должен завершать процесс сразу")
+	default:
+		t.Fatal("second signal is ignored")
+	}
+}
+
+func TestReload(t *testing.T) {
+	m := New(zerolog.Nop(), time.Second)
+	reloads := 0
+	m.OnReload(func() {
+		reloads++
+	})
+	stopped := false
+	m.OnShutdown("servers", func(context.Context) error {
+		stopped = true
+		return nil
+	})
+
+	m.sigc <- syscall.SIGHUP
+	m.sigc <- syscall.SIGHUP
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.sigc <- syscall.SIGTERM
+	}()
+	err := m.Wait()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reloads, "SIGHUP должен перечитывать конфигурацию")
+	assert.True(t, stopped, "SIGHUP не должен останавливать сервисы")
+}
@@ -0,0 +1,68 @@
+// Package logging keep request scoped logger in context, so handlers log with request id and user
+package logging
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+type requestKey struct{}
+
+// request is logging state of one request, user is known only after handler identifies him
+type request struct {
+	mu     sync.Mutex
+	logger zerolog.Logger
+	userID string
+}
+
+// NewContext put request logger to context
+func NewContext(ctx context.Context, logger zerolog.Logger) context.Context {
+	return context.WithValue(ctx, requestKey{}, &request{logger: logger})
+}
+
+// FromContext return request logger. Outside of request zerolog.DefaultContextLogger is returned,
+// or disabled logger when it is not set
+func FromContext(ctx context.Context) *zerolog.Logger {
+	req, ok := ctx.Value(requestKey{}).(*request)
+	if !ok {
+		return zerolog.Ctx(ctx)
+	}
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	logger := req.logger
+	return &logger
+}
+
+// SetUserID add user to request logger and access log line
+func SetUserID(ctx context.Context, userID string) {
+	req, ok := ctx.Value(requestKey{}).(*request)
+	if !ok || len(userID) == 0 {
+		return
+	}
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	if req.userID == userID {
+		return
+	}
+	req.userID = userID
+	req.logger = req.logger.With().Str("user_id", userID).Logger()
+}
+
+// UserID return user set by SetUserID
+func UserID(ctx context.Context) string {
+	req, ok := ctx.Value(requestKey{}).(*request)
+	if !ok {
+		return ""
+	}
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	return req.userID
+}
+
+// OpenFile open log file for append, file is created when it does not exist
+func OpenFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+}
@@ -0,0 +1,112 @@
+// Package metrics contain prometheus metrics of service and handler to expose them
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// redirect results
+const (
+	RedirectHit  = "hit"
+	RedirectMiss = "miss"
+	RedirectGone = "gone"
+)
+
+// Registry keep all metrics of service, it has go runtime and process metrics too
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of http requests by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of http requests by route pattern, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	Redirects = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Number of short link requests by result: hit, miss or gone.",
+	}, []string{"result"})
+
+	StoreDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_operation_duration_seconds",
+		Help:      "Duration of store operations by method and backend.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method", "backend"})
+	StoreErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_operation_errors_total",
+		Help:      "Number of failed store operations by method and backend.",
+	}, []string{"method", "backend"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler expose metrics in prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveStore record duration of store operation and its error
+func ObserveStore(method string, backend string, start time.Time, err error) {
+	StoreDuration.WithLabelValues(method, backend).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StoreErrors.WithLabelValues(method, backend).Inc()
+	}
+}
+
+// RegisterStore add metrics read from store on every scrape: db pool stats, size of file store
+// and depth of background queues. db can be nil when db store is disabled, empty localStore
+// means file store is disabled
+func RegisterStore(db *sql.DB, localStore string, queues map[string]func() int64) {
+	if db != nil {
+		Registry.MustRegister(collectors.NewDBStatsCollector(db, "shortener"))
+	}
+	if len(localStore) > 0 {
+		factory.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "file_store_size_bytes",
+			Help:      "Size of file store.",
+		}, func() float64 {
+			info, err := os.Stat(localStore)
+			if err != nil {
+				return 0
+			}
+			return float64(info.Size())
+		})
+	}
+	for name, depth := range queues {
+		factory.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "background_queue_depth",
+			Help:        "Number of background jobs waiting or running by queue.",
+			ConstLabels: prometheus.Labels{"queue": name},
+		}, func() float64 {
+			return float64(depth())
+		})
+	}
+}
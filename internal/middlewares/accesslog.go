@@ -0,0 +1,76 @@
+// Package middlewares contain middlewares
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Aligator77/go_practice/internal/logging"
+)
+
+// AccessLog write one json line per request to access logger and put request logger with
+// request id to context. Successful requests are sampled, only every sample-th one is written,
+// failed requests are always written: 4xx with warn level, 5xx with error level.
+// middleware.RequestID, middleware.RealIP and Tracing must be used before, middleware.Recoverer after,
+// so panics are logged with status 500. Ids of trace and span are added when request is traced
+func AccessLog(logger zerolog.Logger, access zerolog.Logger, sample uint32) func(http.Handler) http.Handler {
+	sampled := access
+	if sample > 1 {
+		sampled = access.Sample(&zerolog.BasicSampler{N: sample})
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestID := middleware.GetReqID(r.Context())
+			requestLogger := logger.With().Str("request_id", requestID)
+			spanContext := trace.SpanContextFromContext(r.Context())
+			if spanContext.IsValid() {
+				requestLogger = requestLogger.Str("trace_id", spanContext.TraceID().String()).
+					Str("span_id", spanContext.SpanID().String())
+			}
+			ctx := logging.NewContext(r.Context(), requestLogger.Logger())
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			var event *zerolog.Event
+			switch {
+			case status >= http.StatusInternalServerError:
+				event = access.Error()
+			case status >= http.StatusBadRequest:
+				event = access.Warn()
+			default:
+				event = sampled.Info()
+			}
+			if spanContext.IsValid() {
+				event.Str("trace_id", spanContext.TraceID().String())
+			}
+			event.Str("request_id", requestID).
+				Str("method", r.Method).
+				Str("route", routePattern(r)).
+				Int("status", status).
+				Int("bytes", ww.BytesWritten()).
+				Dur("duration", time.Since(start)).
+				Str("user_id", logging.UserID(ctx)).
+				Str("ip", ClientIP(r)).
+				Msg("request")
+		})
+	}
+}
+
+// routePattern return pattern of matched route, so ids of links do not make every line unique
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Aligator77/go_practice/internal/logging"
+)
+
+func TestAccessLog(t *testing.T) {
+	var logs, access bytes.Buffer
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(AccessLog(zerolog.New(&logs), zerolog.New(&access), 2))
+	r.Use(middleware.Recoverer)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUserID(r.Context(), "user-1")
+		logging.FromContext(r.Context()).Info().Msg("handler")
+		_, _ = w.Write([]byte("hello"))
+	})
+	r.Get("/panic/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic("broken")
+	})
+
+	serve := func(path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve("/abc")
+	serve("/def")
+	serve("/panic/abc")
+
+	lines := strings.Split(strings.TrimSpace(access.String()), "\n")
+	require.Len(t, lines, 2, "Успешные запросы должны сэмплироваться, ошибки пишутся всегда")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "GET", line["method"])
+	assert.Equal(t, "/{id}", line["route"], "В логе должен быть шаблон маршрута, а не путь")
+	assert.Equal(t, float64(http.StatusOK), line["status"])
+	assert.Equal(t, float64(5), line["bytes"])
+	assert.Equal(t, "user-1", line["user_id"])
+	assert.Equal(t, "192.0.2.1", line["ip"])
+	assert.NotEmpty(t, line["request_id"])
+	assert.Contains(t, line, "duration")
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &line))
+	assert.Equal(t, "error", line["level"])
+	assert.Equal(t, float64(http.StatusInternalServerError), line["status"], "Паника должна попадать в лог со статусом 500")
+
+	var handlerLine map[string]any
+	require.NoError(t, json.Unmarshal([]byte(strings.Split(logs.String(), "\n")[0]), &handlerLine))
+	assert.Equal(t, "user-1", handlerLine["user_id"], "Логгер запроса должен содержать пользователя")
+	assert.NotEmpty(t, handlerLine["request_id"])
+}
+
+func TestGunzip(t *testing.T) {
+	handler := Gunzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("not gzip"))
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Неверный gzip не должен ронять сервер")
+}
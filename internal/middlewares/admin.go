@@ -0,0 +1,52 @@
+// Package middlewares contain middlewares
+package middlewares
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/Aligator77/go_practice/internal/auth"
+	"github.com/Aligator77/go_practice/internal/server"
+)
+
+type adminCtxKey struct{}
+
+// AdminAuth pass only requests with one of admin tokens in Authorization header,
+// name of token owner is put to context for audit. Without tokens all requests are rejected.
+// Rejected requests are passed to denied before answer, it may be nil
+func AdminAuth(admins []auth.Key, denied func(r *http.Request, reason string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reject := func(reason string) {
+				if denied != nil {
+					denied(r, reason)
+				}
+				_ = server.Render(w, r, server.ErrUnauthorized)
+			}
+			token, ok := auth.BearerToken(r)
+			if !ok {
+				reject("no token")
+				return
+			}
+			// every token is compared, so response time does not tell which admin is matched
+			name := ""
+			for _, admin := range admins {
+				if subtle.ConstantTimeCompare([]byte(token), admin.Secret) == 1 {
+					name = admin.ID
+				}
+			}
+			if len(name) == 0 {
+				reject("unknown token")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminCtxKey{}, name)))
+		})
+	}
+}
+
+// AdminFromContext return name of admin authorized by AdminAuth
+func AdminFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(adminCtxKey{}).(string)
+	return name
+}
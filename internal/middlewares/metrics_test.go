@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Aligator77/go_practice/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Metrics)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	for _, path := range []string{"/abc", "/def", "/a/b/c"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+	assert.Contains(t, string(body), `shortener_http_requests_total{method="GET",route="/{id}",status="307"} 2`, "Запросы должны считаться по шаблону маршрута")
+	assert.Contains(t, string(body), `shortener_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, string(body), `shortener_http_request_duration_seconds_count{method="GET",route="/{id}",status="307"} 2`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
@@ -3,41 +3,35 @@ package middlewares
 
 import (
 	"compress/gzip"
+	"errors"
 	"io"
 	"net/http"
-	"os"
 	"slices"
-	"strconv"
-	"time"
 
-	"github.com/rs/zerolog"
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/server"
 )
 
-// create own middleware func, to pass logger variable
-// создали свою функцию, чтобы пробросить логгер
-func GzipAndLogger(next http.Handler) http.Handler {
+// Gunzip decompress body of requests with Content-Encoding: gzip
+func Gunzip(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
-
-		if slices.Contains(r.Header.Values("Content-Encoding"), "gzip") {
-			gzipReader, err := gzip.NewReader(r.Body)
-			if err != nil {
-				logger.Error().Err(err).Msg("failed to create gzip reader")
-			}
-			defer func(gzipReader *gzip.Reader) {
-				err := gzipReader.Close()
-				if err != nil {
-					logger.Error().Err(err).Msg("failed to close gzip reader")
-				}
-			}(gzipReader)
+		if !slices.Contains(r.Header.Values("Content-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-			r.Body = io.NopCloser(gzipReader)
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			_ = server.Render(w, r, server.ErrInvalidRequest(errors.New("body is not valid gzip")))
+			return
 		}
+		defer func() {
+			if err := gzipReader.Close(); err != nil {
+				logging.FromContext(r.Context()).Error().Err(err).Msg("failed to close gzip reader")
+			}
+		}()
 
-		start := time.Now()
-		// вызываем следующий обработчик
+		r.Body = io.NopCloser(gzipReader)
 		next.ServeHTTP(w, r)
-		duration := time.Since(start)
-		logger.Info().Strs("data", []string{"Time Duration", strconv.FormatInt(int64(duration), 10), "Method", r.Method, "URL.Path", r.URL.Path})
 	})
 }
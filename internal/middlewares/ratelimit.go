@@ -0,0 +1,219 @@
+// Package middlewares contain middlewares
+package middlewares
+
+import (
+	"container/list"
+	"context"
+	"hash/maphash"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Aligator77/go_practice/internal/server"
+)
+
+const (
+	defaultIdleTTL    = 10 * time.Minute
+	defaultMaxBuckets = 100000
+	// maxShards split buckets by hash of key, so requests of different clients
+	// do not wait for one lock
+	maxShards = 16
+)
+
+// RateLimit is token bucket: Burst requests at once, then Rate requests per second
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// shard keep buckets in lru list, the front is used last, so the oldest bucket is
+// found and dropped in constant time
+type shard struct {
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+// Limiter keep one bucket per key. Buckets not used for IdleTTL are evicted by Run,
+// and number of buckets never exceeds MaxBuckets, so memory is bounded.
+// Limit can be changed with Update while requests are served
+type Limiter struct {
+	idleTTL  time.Duration
+	maxShard int
+	seed     maphash.Seed
+	shards   []shard
+	now      func() time.Time
+	limitMu  sync.RWMutex
+	limit    RateLimit
+	disabled bool
+}
+
+// NewLimiter create limiter, zero idleTTL and maxBuckets take default values
+func NewLimiter(limit RateLimit, idleTTL time.Duration, maxBuckets int) *Limiter {
+	if idleTTL <= 0 {
+		idleTTL = defaultIdleTTL
+	}
+	if maxBuckets <= 0 {
+		maxBuckets = defaultMaxBuckets
+	}
+	l := &Limiter{
+		limit:   limit,
+		idleTTL: idleTTL,
+		seed:    maphash.MakeSeed(),
+		now:     time.Now,
+	}
+	// every shard keep equal part of buckets, so together they do not exceed maxBuckets
+	l.shards = make([]shard, min(maxShards, maxBuckets))
+	l.maxShard = maxBuckets / len(l.shards)
+	for i := range l.shards {
+		l.shards[i].buckets = make(map[string]*list.Element)
+		l.shards[i].lru = list.New()
+	}
+	return l
+}
+
+// Allow take one token from bucket of key. It returns tokens left, time until next token
+// when request is rejected and time until bucket is full
+func (l *Limiter) Allow(key string) (ok bool, remaining int, retryAfter time.Duration, reset time.Duration) {
+	limit, _ := l.Limit()
+	burst := float64(limit.Burst)
+	sh := &l.shards[maphash.String(l.seed, key)%uint64(len(l.shards))]
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	now := l.now()
+	var b *bucket
+	if e, found := sh.buckets[key]; found {
+		sh.lru.MoveToFront(e)
+		b = e.Value.(*bucket)
+	} else {
+		if sh.lru.Len() >= l.maxShard {
+			oldest := sh.lru.Back()
+			sh.lru.Remove(oldest)
+			delete(sh.buckets, oldest.Value.(*bucket).key)
+		}
+		b = &bucket{key: key, tokens: burst, last: now}
+		sh.buckets[key] = sh.lru.PushFront(b)
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		retryAfter = l.duration(limit, 1-b.tokens)
+	}
+	return ok, int(b.tokens), retryAfter, l.duration(limit, burst-b.tokens)
+}
+
+// Update set new limit, disabled limiter lets all requests pass. Buckets are kept,
+// tokens over new burst are dropped on next request
+func (l *Limiter) Update(limit RateLimit, enabled bool) {
+	l.limitMu.Lock()
+	defer l.limitMu.Unlock()
+	l.limit = limit
+	l.disabled = !enabled
+}
+
+// Limit return current limit and whether limiter is enabled
+func (l *Limiter) Limit() (RateLimit, bool) {
+	l.limitMu.RLock()
+	defer l.limitMu.RUnlock()
+	return l.limit, !l.disabled
+}
+
+// Len return number of buckets in memory
+func (l *Limiter) Len() int {
+	n := 0
+	for i := range l.shards {
+		l.shards[i].mu.Lock()
+		n += l.shards[i].lru.Len()
+		l.shards[i].mu.Unlock()
+	}
+	return n
+}
+
+// Run evict idle buckets every half of IdleTTL until ctx is done
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.idleTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.sweep()
+		}
+	}
+}
+
+func (l *Limiter) duration(limit RateLimit, tokens float64) time.Duration {
+	if limit.Rate <= 0 {
+		return l.idleTTL
+	}
+	return time.Duration(tokens / limit.Rate * float64(time.Second))
+}
+
+// sweep remove buckets not used for idleTTL, such bucket is full anyway.
+// Buckets are in order of use, so only idle ones at the back are visited
+func (l *Limiter) sweep() {
+	now := l.now()
+	for i := range l.shards {
+		sh := &l.shards[i]
+		sh.mu.Lock()
+		for e := sh.lru.Back(); e != nil && now.Sub(e.Value.(*bucket).last) > l.idleTTL; e = sh.lru.Back() {
+			sh.lru.Remove(e)
+			delete(sh.buckets, e.Value.(*bucket).key)
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// RateLimiter reject requests over limit with 429. Key is built by key func,
+// usually it is user id for authorized requests and client ip for others
+func RateLimiter(l *Limiter, key func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, enabled := l.Limit()
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ok, remaining, retryAfter, reset := l.Allow(key(r))
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(retryAfter))))
+				_ = server.Render(w, r, server.ErrTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP return ip of client without port, TrustedProxies.RealIP must be used before
+// when service is behind proxy
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
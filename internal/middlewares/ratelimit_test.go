@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(RateLimit{Rate: 2, Burst: 3}, time.Minute, 0)
+	l.now = func() time.Time { return now }
+
+	for i := 2; i >= 0; i-- {
+		ok, remaining, _, _ := l.Allow("a")
+		assert.True(t, ok, "Запрос в пределах burst должен проходить")
+		assert.Equal(t, i, remaining)
+	}
+	ok, _, retryAfter, reset := l.Allow("a")
+	assert.False(t, ok, "Запрос сверх burst должен отклоняться")
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+	assert.Equal(t, 1500*time.Millisecond, reset)
+
+	ok, _, _, _ = l.Allow("b")
+	assert.True(t, ok, "У каждого ключа свой bucket")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _, _, _ = l.Allow("a")
+	assert.True(t, ok, "Токен должен восстановиться")
+}
+
+func TestLimiterEviction(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(RateLimit{Rate: 1, Burst: 1}, time.Minute, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		l.Allow("key" + strconv.Itoa(i))
+		now = now.Add(time.Second)
+	}
+	assert.LessOrEqual(t, l.Len(), 3, "Число bucket не должно превышать лимит")
+	assert.Positive(t, l.Len())
+
+	now = now.Add(2 * time.Minute)
+	l.Allow("new")
+	l.sweep()
+	assert.Equal(t, 1, l.Len(), "Неактивные bucket должны удаляться")
+}
+
+func TestLimiterLRU(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(RateLimit{Rate: 1, Burst: 1}, time.Minute, 1)
+	l.now = func() time.Time { return now }
+
+	l.Allow("old")
+	ok, _, _, _ := l.Allow("old")
+	assert.False(t, ok)
+	l.Allow("new")
+	assert.Equal(t, 1, l.Len())
+	ok, _, _, _ = l.Allow("old")
+	assert.True(t, ok, "Самый старый bucket должен вытесняться при переполнении")
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewLimiter(RateLimit{Rate: 0.5, Burst: 1}, time.Minute, 0)
+	handler := RateLimiter(l, ClientIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	r.RemoteAddr = "192.0.2.1:5678"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "Другой порт того же ip не обходит лимит")
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Reset"))
+}
+
+func TestLimiterUpdate(t *testing.T) {
+	l := NewLimiter(RateLimit{Rate: 0.5, Burst: 1}, time.Minute, 0)
+	handler := RateLimiter(l, ClientIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve().Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve().Code)
+
+	l.Update(RateLimit{Rate: 0.5, Burst: 1}, false)
+	w := serve()
+	assert.Equal(t, http.StatusOK, w.Code, "Выключенный лимит пропускает все запросы")
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+
+	l.Update(RateLimit{Rate: 100, Burst: 5}, true)
+	time.Sleep(20 * time.Millisecond)
+	w = serve()
+	assert.Equal(t, http.StatusOK, w.Code, "Новый лимит применяется без перезапуска")
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+}
@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// TrustedProxies tell which peers are proxies of service, X-Real-IP and X-Forwarded-For
+// are accepted only from them, so clients can not choose own ip for rate limiter and logs.
+// Subnets can be changed with Update while requests are served, nil value trusts nobody
+type TrustedProxies struct {
+	nets atomic.Pointer[[]*net.IPNet]
+}
+
+// NewTrustedProxies create trusted proxies from subnets in CIDR form
+func NewTrustedProxies(subnets []string) (*TrustedProxies, error) {
+	p := &TrustedProxies{}
+	return p, p.Update(subnets)
+}
+
+// Update replace trusted subnets, they are kept when one of new subnets is invalid
+func (p *TrustedProxies) Update(subnets []string) error {
+	nets := make([]*net.IPNet, 0, len(subnets))
+	for _, subnet := range subnets {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(subnet))
+		if err != nil {
+			return fmt.Errorf("invalid subnet %q: %w", subnet, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	p.nets.Store(&nets)
+	return nil
+}
+
+// Trusted tell whether ip is in one of trusted subnets
+func (p *TrustedProxies) Trusted(ip net.IP) bool {
+	if p == nil || ip == nil {
+		return false
+	}
+	nets := p.nets.Load()
+	if nets == nil {
+		return false
+	}
+	for _, n := range *nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP return ip of client. Headers are used only when peer is trusted proxy:
+// X-Real-IP first, then the right-most address of X-Forwarded-For, which is not trusted proxy
+func (p *TrustedProxies) ClientIP(peer string, realIP string, forwardedFor string) string {
+	host, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		host = peer
+	}
+	if !p.Trusted(net.ParseIP(host)) {
+		return host
+	}
+	if ip := net.ParseIP(strings.TrimSpace(realIP)); ip != nil {
+		return ip.String()
+	}
+	client := host
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !p.Trusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// RealIP set RemoteAddr of request to ip of client, it replaces middleware.RealIP of chi,
+// which trusts headers of any client
+func (p *TrustedProxies) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = p.ClientIP(r.RemoteAddr, r.Header.Get("X-Real-IP"), r.Header.Get("X-Forwarded-For"))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	p, err := NewTrustedProxies([]string{"10.0.0.0/8", "::1/128"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "192.0.2.1", p.ClientIP("192.0.2.1:1234", "198.51.100.7", "198.51.100.8"),
+		"Заголовки клиента без прокси не учитываются")
+	assert.Equal(t, "198.51.100.7", p.ClientIP("10.0.0.1:1234", "198.51.100.7", ""))
+	assert.Equal(t, "198.51.100.8", p.ClientIP("[::1]:1234", "", "203.0.113.1, 198.51.100.8, 10.0.0.2"),
+		"Берется крайний правый адрес, который не является прокси")
+	assert.Equal(t, "10.0.0.1", p.ClientIP("10.0.0.1:1234", "", "garbage"))
+
+	var none *TrustedProxies
+	assert.Equal(t, "10.0.0.1", none.ClientIP("10.0.0.1:1234", "198.51.100.7", ""))
+
+	assert.Error(t, p.Update([]string{"10.0.0.1"}))
+	assert.Equal(t, "198.51.100.7", p.ClientIP("10.0.0.1:1234", "198.51.100.7", ""), "Невалидная подсеть не меняет список")
+	require.NoError(t, p.Update(nil))
+	assert.Equal(t, "10.0.0.1", p.ClientIP("10.0.0.1:1234", "198.51.100.7", ""))
+}
@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Aligator77/go_practice/internal/tracing"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var access bytes.Buffer
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(Tracing)
+	r.Use(AccessLog(zerolog.Nop(), zerolog.New(&access), 1))
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "URLStore.GetRedirect")
+		span.End()
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	r.Get("/broken/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/broken/abc", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	store, server, broken := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "GET /{id}", server.Name(), "Спан запроса должен называться по шаблону маршрута")
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, traceID, server.SpanContext().TraceID().String(), "Трейс вызывающего должен продолжаться")
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, server.SpanContext().SpanID(), store.Parent().SpanID(), "Спан хранилища должен быть дочерним")
+	assert.Equal(t, codes.Error, broken.Status().Code, "Ответ 5xx должен отмечать спан ошибкой")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal([]byte(strings.Split(access.String(), "\n")[0]), &line))
+	assert.Equal(t, traceID, line["trace_id"], "В логе должен быть id трейса")
+}
@@ -0,0 +1,60 @@
+// Package models contain models for all project
+package models
+
+import "time"
+
+// Admin actions written to audit log
+const (
+	AuditSearchURLs   = "search_urls"
+	AuditViewUserURLs = "view_user_urls"
+	AuditDisableURL   = "disable_url"
+	AuditRestoreURL   = "restore_url"
+	AuditBlockUser    = "block_user"
+	AuditUnblockUser  = "unblock_user"
+	AuditViewAuditLog = "view_audit_log"
+	AuditSetQuota     = "set_quota"
+	AuditAccessDenied = "access_denied"
+
+	// outcomes of admin actions, denied is used for requests with missing or unknown token
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeDenied  = "denied"
+
+	AuditLogDefaultLimit = 100
+	AuditLogMaxLimit     = 1000
+)
+
+// AuditRecord is one admin action, records are never changed or deleted
+type AuditRecord struct {
+	ID         string    `json:"id"`
+	Admin      string    `json:"admin"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target,omitempty"` // short link or user id
+	Detail     string    `json:"detail,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Status     int       `json:"status"` // http status of answer, 0 for records written before it was kept
+	DateCreate time.Time `json:"created_at"`
+}
+
+// BlockedUser can not create new links, existing links keep working
+type BlockedUser struct {
+	UserID     string    `json:"user_id"`
+	Admin      string    `json:"admin"`
+	Reason     string    `json:"reason,omitempty"`
+	DateCreate time.Time `json:"created_at"`
+}
+
+// AdminActionRequest is optional body of admin actions, reason is written to audit log
+type AdminActionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminURLResponse show link with its owner and state
+type AdminURLResponse struct {
+	Slug        string `json:"slug"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	User        string `json:"user"`
+	IsDeleted   bool   `json:"is_deleted"`
+	DateCreate  string `json:"date_create"`
+}
@@ -0,0 +1,92 @@
+// Package models contain models for all project
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// API key scopes, every key has at least one of them
+const (
+	ScopeCreate = "create"
+	ScopeRead   = "read"
+	ScopeDelete = "delete"
+	ScopeStats  = "stats"
+
+	APIKeyNameMaxLen = 100
+)
+
+// APIKeyScopes are all known scopes, key without scopes in request gets all of them
+var APIKeyScopes = []string{ScopeCreate, ScopeRead, ScopeDelete, ScopeStats}
+
+// APIKey is stored without key itself, only its hash is kept
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first symbols of key, help user to find key in list
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	DateCreate time.Time  `json:"created_at"`
+	LastUsed   *time.Time `json:"last_used_at,omitempty"`
+	Revoked    bool       `json:"-"`
+}
+
+// HasScope check key can be used for scope, empty scope is allowed for every key
+func (k APIKey) HasScope(scope string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyRequest is body of api key creation
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Bind validate request after json decoding, missing scopes are replaced by all scopes
+func (k *APIKeyRequest) Bind(r *http.Request) error {
+	if len(k.Name) > APIKeyNameMaxLen {
+		return errors.New("name is too long")
+	}
+	if len(k.Scopes) == 0 {
+		k.Scopes = APIKeyScopes
+		return nil
+	}
+	seen := make(map[string]struct{}, len(k.Scopes))
+	scopes := make([]string, 0, len(k.Scopes))
+	for _, scope := range k.Scopes {
+		if !isKnownScope(scope) {
+			return errors.New("unknown scope " + scope)
+		}
+		if _, ok := seen[scope]; !ok {
+			seen[scope] = struct{}{}
+			scopes = append(scopes, scope)
+		}
+	}
+	k.Scopes = scopes
+	return nil
+}
+
+// APIKeyResponse contain key itself only in response to creation, it can not be shown again
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key,omitempty"`
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+// Package models contain models for all project
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Quota limit links of user, zero value means no limit
+type Quota struct {
+	MaxLiveLinks  int `json:"max_live_links"`
+	MaxDailyLinks int `json:"max_daily_links"`
+}
+
+// QuotaOverride replace global quota for one user, nil fields keep global values
+type QuotaOverride struct {
+	MaxLiveLinks  *int `json:"max_live_links"`
+	MaxDailyLinks *int `json:"max_daily_links"`
+}
+
+// Bind validate override after json decoding
+func (q *QuotaOverride) Bind(r *http.Request) error {
+	if q.MaxLiveLinks != nil && *q.MaxLiveLinks < 0 || q.MaxDailyLinks != nil && *q.MaxDailyLinks < 0 {
+		return errors.New("quota can not be negative, 0 means no limit")
+	}
+	return nil
+}
+
+// Apply return quota with overridden fields
+func (q QuotaOverride) Apply(quota Quota) Quota {
+	if q.MaxLiveLinks != nil {
+		quota.MaxLiveLinks = *q.MaxLiveLinks
+	}
+	if q.MaxDailyLinks != nil {
+		quota.MaxDailyLinks = *q.MaxDailyLinks
+	}
+	return quota
+}
+
+// QuotaUsage count links of user, daily links are counted from start of current day
+type QuotaUsage struct {
+	LiveLinks  int `json:"live_links"`
+	DailyLinks int `json:"daily_links"`
+}
+
+// Allowed return how many of n links can be created
+func (q Quota) Allowed(usage QuotaUsage, n int) int {
+	if q.MaxLiveLinks > 0 {
+		n = min(n, max(0, q.MaxLiveLinks-usage.LiveLinks))
+	}
+	if q.MaxDailyLinks > 0 {
+		n = min(n, max(0, q.MaxDailyLinks-usage.DailyLinks))
+	}
+	return n
+}
+
+// QuotaResponse is answer of GET /api/user/quota
+type QuotaResponse struct {
+	Quota
+	QuotaUsage
+	DailyResetAt time.Time `json:"daily_reset_at"`
+}
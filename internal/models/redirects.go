@@ -1,7 +1,18 @@
 // Package models contain models for all project
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// memory store keep dates as time.Time.String(), db returns them in RFC3339
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999",
+}
 
 type Redirect struct {
 	ID         string `json:"uuid"`
@@ -11,6 +22,9 @@ type Redirect struct {
 	DateCreate string `json:"dateCreate"`
 	DateUpdate string `json:"dateUpdate"`
 	User       string `json:"user"`
+	DateExpire string `json:"dateExpire,omitempty"`
+	// CanonicalURL is used for deduplication, URL is kept as user sent it
+	CanonicalURL string `json:"canonicalUrl,omitempty"`
 }
 
 func (r Redirect) String() string {
@@ -20,3 +34,39 @@ func (r Redirect) String() string {
 	}
 	return string(res)
 }
+
+// URLKey return url used for search of duplicates
+func (r Redirect) URLKey() string {
+	if len(r.CanonicalURL) > 0 {
+		return r.CanonicalURL
+	}
+	return r.URL
+}
+
+// Created return DateCreate as time, zero time returned when date can not be parsed
+func (r Redirect) Created() time.Time {
+	return ParseDate(r.DateCreate)
+}
+
+// Expired check redirect has expiration date in past
+func (r Redirect) Expired() bool {
+	if len(r.DateExpire) == 0 {
+		return false
+	}
+	expire := ParseDate(r.DateExpire)
+	return !expire.IsZero() && expire.Before(time.Now())
+}
+
+// ParseDate parse dates written by memory and db stores
+func ParseDate(date string) time.Time {
+	// drop monotonic clock reading, added by time.Now().String()
+	if i := strings.Index(date, " m="); i > 0 {
+		date = date[:i]
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
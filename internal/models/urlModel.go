@@ -4,6 +4,26 @@ package models
 import (
 	"io"
 	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	URLStatusAll     = "all"
+	URLStatusLive    = "live"
+	URLStatusDeleted = "deleted"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+
+	URLListDefaultLimit = 100
+	URLListMaxLimit     = 1000
+
+	ImportCreated   = "created"
+	ImportDuplicate = "duplicate" // destination is already shortened
+	ImportConflict  = "conflict"  // alias belongs to another link
+	ImportInvalid   = "invalid"
+	ImportFailed    = "error"
 )
 
 type URLData struct {
@@ -23,6 +43,52 @@ type URLBatchResponse struct {
 	CorrelationID string `json:"correlation_id,omitempty"`
 	ShortURL      string `json:"short_url,omitempty"`
 	OriginalURL   string `json:"original_url,omitempty"`
+	Error         string `json:"error,omitempty"` // filled when batch item was not created
+}
+
+// URLListFilter describe one page of user urls listing
+type URLListFilter struct {
+	Status      string    // all, live or deleted
+	CreatedFrom time.Time // zero value disable filter
+	CreatedTo   time.Time // zero value disable filter
+	Query       string    // substring of original url
+	Sort        string    // asc or desc by date of creation
+	Limit       int
+	Cursor      string // opaque value from previous page
+}
+
+// URLImportRow is one line of imported csv or jsonl file
+type URLImportRow struct {
+	OriginalURL string `json:"original_url"`
+	Alias       string `json:"alias,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+}
+
+// URLImportResult is report about one imported row
+type URLImportResult struct {
+	Row         int    `json:"row"`
+	Status      string `json:"status"`
+	ShortURL    string `json:"short_url,omitempty"`
+	OriginalURL string `json:"original_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// URLExportRow is one exported users link
+type URLExportRow struct {
+	Slug        string `json:"slug"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	DateCreate  string `json:"date_create"`
+	DateUpdate  string `json:"date_update"`
+	IsDeleted   bool   `json:"is_deleted"`
+}
+
+// URLExportHeader is header of exported csv file, order is the same as in URLExportRow.Record
+var URLExportHeader = []string{"slug", "short_url", "original_url", "date_create", "date_update", "is_deleted"}
+
+// Record return row as csv record
+func (e URLExportRow) Record() []string {
+	return []string{e.Slug, e.ShortURL, e.OriginalURL, e.DateCreate, e.DateUpdate, strconv.FormatBool(e.IsDeleted)}
 }
 
 func (u URLData) Bind(r *http.Request) error {
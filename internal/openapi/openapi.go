@@ -0,0 +1,517 @@
+// Package openapi contain OpenAPI 3 document of REST api and handlers to serve it with docs page
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Aligator77/go_practice/internal/handlers"
+	"github.com/Aligator77/go_practice/internal/helpers"
+	"github.com/Aligator77/go_practice/internal/models"
+	"github.com/Aligator77/go_practice/internal/server"
+)
+
+// Version is version of OpenAPI specification used by document
+const Version = "3.0.3"
+
+//go:embed docs.html
+var docsPage []byte
+
+// Document is OpenAPI document, paths are keyed by chi route pattern and lower case method
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Tags       []Tag                            `json:"tags"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type Operation struct {
+	Tags        []string              `json:"tags"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+// security requirements of operations
+var (
+	userSecurity  = []map[string][]string{{"userCookie": {}}, {"apiKey": {}}}
+	adminSecurity = []map[string][]string{{"adminToken": {}}}
+)
+
+func intRange(lo int, hi int) (*int, *int) {
+	return &lo, &hi
+}
+
+func content(mediaType string, schema *Schema) map[string]MediaType {
+	return map[string]MediaType{mediaType: {Schema: schema}}
+}
+
+func jsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: content("application/json", schema)}
+}
+
+func pathParam(name string, description string) Parameter {
+	return Parameter{Name: name, In: "path", Required: true, Description: description, Schema: &Schema{Type: "string"}}
+}
+
+func queryParam(name string, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// builder collect operations and schemas of document
+type builder struct {
+	doc     *Document
+	schemas schemas
+}
+
+func (b *builder) add(method string, path string, op *Operation) {
+	if b.doc.Paths[path] == nil {
+		b.doc.Paths[path] = map[string]*Operation{}
+	}
+	b.doc.Paths[path][strings.ToLower(method)] = op
+}
+
+// problem is error response in RFC 7807 format, see server.ErrResponse
+func (b *builder) problem(description string) Response {
+	return Response{Description: description, Content: content(server.ProblemContentType, b.schemas.ref(server.ErrResponse{}))}
+}
+
+// problems add common error responses of codes
+func (b *builder) problems(responses map[string]Response, codes ...int) map[string]Response {
+	descriptions := map[int]string{
+		http.StatusBadRequest:            "Invalid request, url or destination rejected by policy.",
+		http.StatusUnauthorized:          "Credentials are forged, expired or api key is revoked.",
+		http.StatusForbidden:             "Api key has no scope, user is blocked or quota is exceeded.",
+		http.StatusNotFound:              "Short link is not found.",
+		http.StatusGone:                  "Short link is deleted or expired.",
+		http.StatusConflict:              "Url is already shortened, existing short link is in result member.",
+		http.StatusRequestEntityTooLarge: "Request body is too large.",
+		http.StatusTooManyRequests:       "Rate limit exceeded, see Retry-After header.",
+		http.StatusInternalServerError:   "Storage failure.",
+	}
+	for _, code := range codes {
+		res := b.problem(descriptions[code])
+		if code == http.StatusTooManyRequests {
+			res.Headers = map[string]Header{"Retry-After": {Description: "Seconds to wait.", Schema: &Schema{Type: "integer"}}}
+		}
+		responses[strconv.Itoa(code)] = res
+	}
+	return responses
+}
+
+func (b *builder) jsonResponse(description string, v any) Response {
+	return Response{Description: description, Content: content("application/json", b.schemas.ref(v))}
+}
+
+// listParams are query params of url lists, see models.URLListFilter
+func listParams() []Parameter {
+	minLimit, maxLimit := intRange(1, models.URLListMaxLimit)
+	return []Parameter{
+		queryParam("limit", "Page size.", &Schema{Type: "integer", Default: models.URLListDefaultLimit, Minimum: minLimit, Maximum: maxLimit}),
+		queryParam("cursor", "Cursor of next page from X-Next-Cursor header.", &Schema{Type: "string"}),
+		queryParam("status", "Filter by status.", &Schema{Type: "string", Enum: []string{models.URLStatusAll, models.URLStatusLive, models.URLStatusDeleted}, Default: models.URLStatusAll}),
+		queryParam("sort", "Order by date of creation.", &Schema{Type: "string", Enum: []string{models.SortAsc, models.SortDesc}, Default: models.SortAsc}),
+		queryParam("created_from", "Created at or after, RFC 3339.", &Schema{Type: "string", Format: "date-time"}),
+		queryParam("created_to", "Created before, RFC 3339.", &Schema{Type: "string", Format: "date-time"}),
+		queryParam("q", "Substring of original url, case insensitive.", &Schema{Type: "string"}),
+	}
+}
+
+var pageHeaders = map[string]Header{
+	"X-Next-Cursor": {Description: "Cursor of next page, absent on the last page.", Schema: &Schema{Type: "string"}},
+	"Link":          {Description: `Url of next page with rel="next".`, Schema: &Schema{Type: "string"}},
+}
+
+// Spec build document of all routes of public router, version is version of service
+func Spec(version string) *Document {
+	b := &builder{
+		doc: &Document{
+			OpenAPI: Version,
+			Info: Info{
+				Title: "URL shortener",
+				Description: "Short links for urls. Users are identified by signed `user` cookie, it is set on the first request " +
+					"which creates links, or by api key in `Authorization: Bearer` header. Errors are RFC 7807 problem details.",
+				Version: version,
+			},
+			Tags: []Tag{
+				{Name: "links", Description: "Create short links and follow them."},
+				{Name: "user", Description: "Links, api keys and quota of user."},
+				{Name: "admin", Description: "Moderation, needs admin token."},
+				{Name: "service", Description: "Health checks and api description."},
+			},
+			Paths: map[string]map[string]*Operation{},
+			Components: Components{
+				SecuritySchemes: map[string]SecurityScheme{
+					"userCookie": {Type: "apiKey", In: "cookie", Name: "user", Description: "Signed user id, it is set by server."},
+					"apiKey":     {Type: "http", Scheme: "bearer", Description: "Api key created by POST /api/user/keys."},
+					"adminToken": {Type: "http", Scheme: "bearer", Description: "One of ADMIN_TOKENS."},
+				},
+			},
+		},
+		schemas: schemas{},
+	}
+	b.links()
+	b.user()
+	b.admin()
+	b.service()
+	b.doc.Components.Schemas = b.schemas
+	return b.doc
+}
+
+func (b *builder) links() {
+	plainURL := &Schema{Type: "string", Format: "uri", Example: "https://practicum.yandex.ru/"}
+	shortURL := &Schema{Type: "string", Format: "uri", Example: "http://localhost:8080/EwHXdJfB"}
+
+	b.add(http.MethodPost, "/", &Operation{
+		Tags: []string{"links"}, OperationID: "shortenText", Summary: "Shorten url sent as text",
+		Security:    userSecurity,
+		RequestBody: &RequestBody{Required: true, Content: content("text/plain", plainURL)},
+		Responses: b.problems(map[string]Response{
+			"201": {Description: "Short link is created.", Content: content("text/plain", shortURL)},
+			"409": {Description: "Url is already shortened, existing short link is returned.", Content: content("text/plain", shortURL)},
+		}, 400, 401, 403, 429, 500),
+	})
+	b.add(http.MethodPost, "/api/shorten", &Operation{
+		Tags: []string{"links"}, OperationID: "shorten", Summary: "Shorten url",
+		Security:    userSecurity,
+		RequestBody: jsonBody(b.schemas.ref(models.URLData{})),
+		Responses: b.problems(map[string]Response{
+			"201": b.jsonResponse("Short link is created.", models.URLDataResponse{}),
+			"409": b.problem("Url is already shortened, existing short link is in result member."),
+		}, 400, 401, 403, 429, 500),
+	})
+	b.add(http.MethodPost, "/api/shorten/batch", &Operation{
+		Tags: []string{"links"}, OperationID: "shortenBatch", Summary: "Shorten many urls",
+		Description: "Items are checked one by one, failed items have error and do not stop others.",
+		Security:    userSecurity,
+		RequestBody: jsonBody(b.schemas.ref(models.URLBatchData{})),
+		Responses: b.problems(map[string]Response{
+			"201": b.jsonResponse("All links are created.", []models.URLBatchResponse{}),
+			"207": b.jsonResponse("Some items failed.", []models.URLBatchResponse{}),
+		}, 400, 401, 403, 413, 429, 500),
+	})
+	b.add(http.MethodGet, "/{id}", &Operation{
+		Tags: []string{"links"}, OperationID: "follow", Summary: "Follow short link",
+		Parameters: []Parameter{pathParam("id", "Short link.")},
+		Responses: b.problems(map[string]Response{
+			"307": {Description: "Redirect to original url.", Headers: map[string]Header{
+				"Location": {Description: "Original url.", Schema: plainURL},
+			}},
+		}, 400, 404, 410, 429, 500),
+	})
+	minSize, maxSize := intRange(helpers.QRMinSize, helpers.QRMaxSize)
+	minMargin, maxMargin := intRange(0, helpers.QRMaxMargin)
+	defaultQR := helpers.DefaultQROptions()
+	b.add(http.MethodGet, "/{id}/qr", &Operation{
+		Tags: []string{"links"}, OperationID: "qrCode", Summary: "QR code of short link",
+		Parameters: []Parameter{
+			pathParam("id", "Short link."),
+			queryParam("size", "Size in pixels, png smaller than code modules is rejected.", &Schema{Type: "integer", Default: defaultQR.Size, Minimum: minSize, Maximum: maxSize}),
+			queryParam("margin", "Quiet zone in modules.", &Schema{Type: "integer", Default: defaultQR.Margin, Minimum: minMargin, Maximum: maxMargin}),
+			queryParam("level", "Error correction level.", &Schema{Type: "string", Enum: []string{"L", "M", "Q", "H"}, Default: defaultQR.Level}),
+			queryParam("format", "Image format.", &Schema{Type: "string", Enum: []string{helpers.QRFormatPNG, helpers.QRFormatSVG}, Default: helpers.QRFormatPNG}),
+		},
+		Responses: b.problems(map[string]Response{
+			"200": {Description: "Image, it can be cached by ETag.", Content: map[string]MediaType{
+				"image/png":     {Schema: &Schema{Type: "string", Format: "binary"}},
+				"image/svg+xml": {Schema: &Schema{Type: "string"}},
+			}},
+			"304": {Description: "Image is not modified."},
+		}, 400, 404, 410, 429, 500),
+	})
+}
+
+func (b *builder) user() {
+	b.add(http.MethodGet, "/api/user/urls", &Operation{
+		Tags: []string{"user"}, OperationID: "listUserURLs", Summary: "Links of user",
+		Security:   userSecurity,
+		Parameters: listParams(),
+		Responses: b.problems(map[string]Response{
+			"200": {Description: "Page of links.", Headers: pageHeaders, Content: content("application/json", b.schemas.ref([]models.URLBatchResponse{}))},
+			"204": {Description: "User has no links."},
+		}, 400, 401, 403, 500),
+	})
+	b.add(http.MethodPost, "/api/user/urls", &Operation{
+		Tags: []string{"user"}, OperationID: "createUserURL", Summary: "Shorten url",
+		Description: "The same as POST /api/shorten.",
+		Security:    userSecurity,
+		RequestBody: jsonBody(b.schemas.ref(models.URLData{})),
+		Responses: b.problems(map[string]Response{
+			"201": b.jsonResponse("Short link is created.", models.URLDataResponse{}),
+			"409": b.problem("Url is already shortened, existing short link is in result member."),
+		}, 400, 401, 403, 429, 500),
+	})
+	b.add(http.MethodDelete, "/api/user/urls", &Operation{
+		Tags: []string{"user"}, OperationID: "deleteUserURLs", Summary: "Delete links of user",
+		Description: "Links are deleted in background, links of other users are skipped.",
+		Security:    userSecurity,
+		RequestBody: jsonBody(&Schema{Type: "array", Items: &Schema{Type: "string"}, Example: []string{"EwHXdJfB"}}),
+		Responses: b.problems(map[string]Response{
+			"202": {Description: "Delete is accepted."},
+		}, 400, 401, 403),
+	})
+	b.add(http.MethodPatch, "/api/user/urls/{id}", &Operation{
+		Tags: []string{"user"}, OperationID: "updateUserURL", Summary: "Change original url of link",
+		Security:    userSecurity,
+		Parameters:  []Parameter{pathParam("id", "Short link.")},
+		RequestBody: jsonBody(b.schemas.ref(models.URLData{})),
+		Responses: b.problems(map[string]Response{
+			"200": b.jsonResponse("Link is changed.", models.URLBatchResponse{}),
+		}, 400, 401, 403, 404, 409, 410, 500),
+	})
+	b.add(http.MethodPost, "/api/user/urls/import", &Operation{
+		Tags: []string{"user"}, OperationID: "importUserURLs", Summary: "Import links from csv or jsonl",
+		Description: "Csv columns are original_url, alias, expires_at, header row is optional. Result of every row " +
+			"is streamed as one json line, so status is 200 even when rows fail. Row status is created, duplicate " +
+			"(original_url is already shortened), conflict (alias belongs to another link), invalid or error. " +
+			"Aliases equal to names of service routes, like api or health, are invalid.",
+		Security: userSecurity,
+		Parameters: []Parameter{
+			queryParam("format", "Format of body, Content-Type is used when empty.", &Schema{Type: "string", Enum: []string{"csv", "jsonl"}}),
+		},
+		RequestBody: &RequestBody{Required: true, Content: map[string]MediaType{
+			"text/csv":             {Schema: &Schema{Type: "string"}},
+			"application/x-ndjson": {Schema: b.schemas.ref(models.URLImportRow{})},
+		}},
+		Responses: b.problems(map[string]Response{
+			"200": {Description: "Result of every row.", Content: content("application/x-ndjson", b.schemas.ref(models.URLImportResult{}))},
+		}, 400, 401, 403, 429),
+	})
+	b.add(http.MethodGet, "/api/user/urls/export", &Operation{
+		Tags: []string{"user"}, OperationID: "exportUserURLs", Summary: "Export links of user",
+		Security: userSecurity,
+		Parameters: []Parameter{
+			queryParam("format", "Format of file.", &Schema{Type: "string", Enum: []string{"csv", "ndjson"}, Default: "csv"}),
+		},
+		Responses: b.problems(map[string]Response{
+			"200": {Description: "File with all links, it is streamed, so failure after first rows breaks connection without end of body.", Content: map[string]MediaType{
+				"text/csv":             {Schema: &Schema{Type: "string"}},
+				"application/x-ndjson": {Schema: b.schemas.ref(models.URLExportRow{})},
+			}},
+		}, 400, 401, 403, 500),
+	})
+	b.add(http.MethodPost, "/api/user/keys", &Operation{
+		Tags: []string{"user"}, OperationID: "createAPIKey", Summary: "Create api key",
+		Description: "Keys are managed only with user cookie. Key itself is returned only once.",
+		Security:    []map[string][]string{{"userCookie": {}}},
+		RequestBody: jsonBody(b.schemas.ref(models.APIKeyRequest{})),
+		Responses: b.problems(map[string]Response{
+			"201": b.jsonResponse("Key is created.", models.APIKeyResponse{}),
+		}, 400, 401, 403, 500),
+	})
+	b.add(http.MethodGet, "/api/user/keys", &Operation{
+		Tags: []string{"user"}, OperationID: "listAPIKeys", Summary: "Api keys of user",
+		Security: []map[string][]string{{"userCookie": {}}},
+		Responses: b.problems(map[string]Response{
+			"200": b.jsonResponse("Keys without secrets.", []models.APIKey{}),
+		}, 401, 403, 500),
+	})
+	b.add(http.MethodDelete, "/api/user/keys/{id}", &Operation{
+		Tags: []string{"user"}, OperationID: "revokeAPIKey", Summary: "Revoke api key",
+		Security:   []map[string][]string{{"userCookie": {}}},
+		Parameters: []Parameter{pathParam("id", "Id of key.")},
+		Responses: b.problems(map[string]Response{
+			"204": {Description: "Key is revoked."},
+		}, 401, 403, 404, 500),
+	})
+	b.add(http.MethodGet, "/api/user/quota", &Operation{
+		Tags: []string{"user"}, OperationID: "userQuota", Summary: "Quota of user and its usage",
+		Description: "Zero limit means no limit.",
+		Security:    userSecurity,
+		Responses: b.problems(map[string]Response{
+			"200": b.jsonResponse("Quota and usage.", models.QuotaResponse{}),
+		}, 401, 403, 500),
+	})
+}
+
+func (b *builder) admin() {
+	action := &RequestBody{Content: content("application/json", b.schemas.ref(models.AdminActionRequest{}))}
+	userParam := pathParam("userID", "Id of user.")
+	b.add(http.MethodGet, "/api/admin/urls", &Operation{
+		Tags: []string{"admin"}, OperationID: "adminSearchURLs", Summary: "Search links of all users",
+		Security:   adminSecurity,
+		Parameters: listParams(),
+		Responses: b.problems(map[string]Response{
+			"200": {Description: "Page of links.", Headers: pageHeaders, Content: content("application/json", b.schemas.ref([]models.AdminURLResponse{}))},
+		}, 400, 401, 500),
+	})
+	for _, op := range []struct{ path, id, summary string }{
+		{"/api/admin/urls/{id}/disable", "adminDisableURL", "Disable link"},
+		{"/api/admin/urls/{id}/restore", "adminRestoreURL", "Restore disabled link"},
+	} {
+		b.add(http.MethodPost, op.path, &Operation{
+			Tags: []string{"admin"}, OperationID: op.id, Summary: op.summary,
+			Security:    adminSecurity,
+			Parameters:  []Parameter{pathParam("id", "Short link.")},
+			RequestBody: action,
+			Responses: b.problems(map[string]Response{
+				"200": b.jsonResponse("Changed link.", models.AdminURLResponse{}),
+			}, 400, 401, 404, 500),
+		})
+	}
+	b.add(http.MethodGet, "/api/admin/users/{userID}/urls", &Operation{
+		Tags: []string{"admin"}, OperationID: "adminUserURLs", Summary: "Links of user",
+		Security:   adminSecurity,
+		Parameters: append([]Parameter{userParam}, listParams()...),
+		Responses: b.problems(map[string]Response{
+			"200": {Description: "Page of links.", Headers: pageHeaders, Content: content("application/json", b.schemas.ref([]models.AdminURLResponse{}))},
+		}, 400, 401, 500),
+	})
+	b.add(http.MethodPost, "/api/admin/users/{userID}/block", &Operation{
+		Tags: []string{"admin"}, OperationID: "adminBlockUser", Summary: "Forbid user to create links",
+		Security:    adminSecurity,
+		Parameters:  []Parameter{userParam},
+		RequestBody: action,
+		Responses: b.problems(map[string]Response{
+			"204": {Description: "User is blocked."},
+		}, 400, 401, 500),
+	})
+	b.add(http.MethodDelete, "/api/admin/users/{userID}/block", &Operation{
+		Tags: []string{"admin"}, OperationID: "adminUnblockUser", Summary: "Unblock user",
+		Security:    adminSecurity,
+		Parameters:  []Parameter{userParam},
+		RequestBody: action,
+		Responses: b.problems(map[string]Response{
+			"204": {Description: "User is unblocked."},
+		}, 400, 401, 500),
+	})
+	b.add(http.MethodPut, "/api/admin/users/{userID}/quota", &Operation{
+		Tags: []string{"admin"}, OperationID: "adminSetQuota", Summary: "Override quota of user",
+		Description: "Null limit falls back to global quota.",
+		Security:    adminSecurity,
+		Parameters:  []Parameter{userParam},
+		RequestBody: jsonBody(b.schemas.ref(models.QuotaOverride{})),
+		Responses: b.problems(map[string]Response{
+			"200": b.jsonResponse("Effective quota of user.", models.Quota{}),
+		}, 400, 401, 500),
+	})
+	minLimit, maxLimit := intRange(1, models.AuditLogMaxLimit)
+	b.add(http.MethodGet, "/api/admin/audit", &Operation{
+		Tags: []string{"admin"}, OperationID: "adminAudit", Summary: "Last admin actions",
+		Security: adminSecurity,
+		Parameters: []Parameter{
+			queryParam("limit", "Number of records.", &Schema{Type: "integer", Default: models.AuditLogDefaultLimit, Minimum: minLimit, Maximum: maxLimit}),
+		},
+		Responses: b.problems(map[string]Response{
+			"200": b.jsonResponse("Records, newest first.", []models.AuditRecord{}),
+		}, 400, 401, 500),
+	})
+}
+
+func (b *builder) service() {
+	b.add(http.MethodGet, "/ping", &Operation{
+		Tags: []string{"service"}, OperationID: "ping", Summary: "Check connection to db",
+		Responses: b.problems(map[string]Response{
+			"200": {Description: "Db is available or disabled."},
+		}, 500),
+	})
+	b.add(http.MethodGet, "/health", &Operation{
+		Tags: []string{"service"}, OperationID: "health", Summary: "Process is running",
+		Responses: map[string]Response{
+			"200": b.jsonResponse("Version of service.", handlers.HealthResponse{}),
+		},
+	})
+	for _, op := range []struct{ path, id, summary string }{
+		{"/livez", "livez", "Liveness probe"},
+		{"/readyz", "readyz", "Readiness probe, it fails during shutdown"},
+	} {
+		b.add(http.MethodGet, op.path, &Operation{
+			Tags: []string{"service"}, OperationID: op.id, Summary: op.summary,
+			Responses: map[string]Response{
+				"200": b.jsonResponse("All checks passed.", handlers.ProbeResponse{}),
+				"503": b.jsonResponse("Some checks failed.", handlers.ProbeResponse{}),
+			},
+		})
+	}
+	b.add(http.MethodGet, "/openapi.json", &Operation{
+		Tags: []string{"service"}, OperationID: "openapi", Summary: "This document",
+		Responses: map[string]Response{
+			"200": {Description: "OpenAPI document.", Content: content("application/json", &Schema{Type: "object"})},
+		},
+	})
+	b.add(http.MethodGet, "/docs", &Operation{
+		Tags: []string{"service"}, OperationID: "docs", Summary: "Interactive docs of api",
+		Responses: map[string]Response{
+			"200": {Description: "Docs page.", Content: content("text/html", &Schema{Type: "string"})},
+		},
+	})
+}
+
+// Handler serve document, it is built once
+func Handler(version string) http.HandlerFunc {
+	data, err := json.Marshal(Spec(version))
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// Docs serve docs page, it reads /openapi.json and has no external dependencies
+func Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(docsPage)
+}
@@ -0,0 +1,114 @@
+// Package openapi contain OpenAPI 3 document of REST api and handlers to serve it with docs page
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is OpenAPI schema object, only fields used by this api are here
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Example              any                `json:"example,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemas build component schemas from go types by their json tags,
+// named structs become components and are referenced by name
+type schemas map[string]*Schema
+
+// ref return schema of value type, named struct and slice types are added to components
+func (s schemas) ref(v any) *Schema {
+	return s.of(reflect.TypeOf(v))
+}
+
+func (s schemas) of(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := *s.of(t.Elem())
+		if len(schema.Ref) > 0 {
+			// $ref siblings are ignored by OpenAPI 3.0, so nullable reference is wrapped
+			return &Schema{Nullable: true, AllOf: []*Schema{&schema}}
+		}
+		schema.Nullable = true
+		return &schema
+	}
+
+	named := len(t.Name()) > 0 && (t.Kind() == reflect.Struct || t.Kind() == reflect.Slice)
+	if named {
+		if _, ok := s[t.Name()]; !ok {
+			// placeholder stops recursion of self-referencing types
+			s[t.Name()] = &Schema{}
+			*s[t.Name()] = *s.build(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return s.build(t)
+}
+
+func (s schemas) build(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		s.fields(t, schema)
+		return schema
+	}
+	return &Schema{}
+}
+
+// fields add json fields of struct to schema, embedded structs are flattened the same as by encoding/json
+func (s schemas) fields(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && len(name) == 0 && field.Type.Kind() == reflect.Struct {
+			s.fields(field.Type, schema)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		schema.Properties[name] = s.of(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Aligator77/go_practice/internal/models"
+)
+
+func TestSchemas(t *testing.T) {
+	s := schemas{}
+
+	ref := s.ref(models.QuotaResponse{})
+	assert.Equal(t, "#/components/schemas/QuotaResponse", ref.Ref)
+	quota := s["QuotaResponse"]
+	require.NotNil(t, quota)
+	assert.Equal(t, "object", quota.Type)
+	assert.Contains(t, quota.Properties, "max_live_links", "Встроенные структуры должны раскрываться как в encoding/json")
+	assert.Contains(t, quota.Properties, "live_links")
+	assert.Equal(t, "date-time", quota.Properties["daily_reset_at"].Format)
+
+	s.ref(models.APIKeyResponse{})
+	key := s["APIKeyResponse"]
+	assert.NotContains(t, key.Properties, "UserID", "Поля с json:\"-\" не попадают в схему")
+	assert.NotContains(t, key.Properties, "Hash")
+	assert.True(t, key.Properties["last_used_at"].Nullable)
+	assert.Equal(t, "array", key.Properties["scopes"].Type)
+	assert.NotContains(t, key.Required, "key", "Поля с omitempty необязательны")
+	assert.Contains(t, key.Required, "id")
+
+	s.ref(models.URLBatchData{})
+	batch := s["URLBatchData"]
+	assert.Equal(t, "array", batch.Type)
+	assert.Contains(t, batch.Items.Properties, "correlation_id")
+}
+
+func TestSpec(t *testing.T) {
+	spec := Spec("1.2.3")
+	ids := map[string]bool{}
+	for path, operations := range spec.Paths {
+		for method, op := range operations {
+			assert.False(t, ids[op.OperationID], "operationId %s повторяется", op.OperationID)
+			ids[op.OperationID] = true
+			for _, segment := range strings.Split(path, "/") {
+				if !strings.HasPrefix(segment, "{") {
+					continue
+				}
+				name := strings.Trim(segment, "{}")
+				found := false
+				for _, p := range op.Parameters {
+					found = found || p.In == "path" && p.Name == name
+				}
+				assert.True(t, found, "%s %s не описывает параметр пути %s", method, path, name)
+			}
+			for _, ref := range refs(op) {
+				_, ok := spec.Components.Schemas[ref]
+				assert.True(t, ok, "%s %s ссылается на отсутствующую схему %s", method, path, ref)
+			}
+		}
+	}
+}
+
+// refs return names of component schemas referenced directly by operation
+func refs(op *Operation) (names []string) {
+	add := func(content map[string]MediaType) {
+		for _, media := range content {
+			if schema := media.Schema; schema != nil && len(schema.Ref) > 0 {
+				names = append(names, schema.Ref[len("#/components/schemas/"):])
+			}
+		}
+	}
+	if op.RequestBody != nil {
+		add(op.RequestBody.Content)
+	}
+	for _, res := range op.Responses {
+		add(res.Content)
+	}
+	return names
+}
@@ -0,0 +1,267 @@
+// Package policy check destination urls before they are stored
+package policy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ModeBlock = "block" // domains from list are rejected
+	ModeAllow = "allow" // only domains from list are accepted
+
+	resolveTimeout = 2 * time.Second
+)
+
+var (
+	ErrScheme          = errors.New("url scheme is not allowed")
+	ErrDomainBlocked   = errors.New("url domain is blocked")
+	ErrDomainNotListed = errors.New("url domain is not in allow list")
+	ErrPrivateAddress  = errors.New("url points to private, loopback or link-local address")
+	ErrSelfReference   = errors.New("url points to this shortener")
+	ErrNestedShortLink = errors.New("url is a link of another shortener")
+)
+
+// DefaultShorteners are known link shorteners, links to them create redirect chains
+var DefaultShorteners = []string{"bit.ly", "t.co", "goo.gl", "tinyurl.com", "ow.ly", "is.gd", "buff.ly", "cutt.ly", "clck.ru", "rebrand.ly"}
+
+// cgnatNet is shared address space of carrier-grade NAT, it is not public too
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+type Config struct {
+	Schemes        []string // allowed schemes, http and https when empty
+	DomainListFile string   // file with one domain per line, lines started with # are skipped
+	DomainListMode string   // block or allow
+	AllowPrivate   bool     // accept private, loopback and link-local targets
+	ResolveHosts   bool     // resolve host names to check their addresses too
+	BaseURL        string   // links to own host create redirect loop
+	Shorteners     []string // hosts of other shorteners
+}
+
+// Policy is immutable after New, so it can be shared between goroutines
+type Policy struct {
+	schemes      map[string]struct{}
+	domains      map[string]struct{}
+	mode         string
+	allowPrivate bool
+	resolveHosts bool
+	selfHosts    map[string]struct{}
+	shorteners   map[string]struct{}
+
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// New create policy and load domain list from file
+func New(cfg Config) (*Policy, error) {
+	p := &Policy{
+		schemes:      make(map[string]struct{}),
+		domains:      make(map[string]struct{}),
+		mode:         ModeBlock,
+		allowPrivate: cfg.AllowPrivate,
+		resolveHosts: cfg.ResolveHosts,
+		selfHosts:    make(map[string]struct{}),
+		shorteners:   make(map[string]struct{}),
+		lookup:       net.DefaultResolver.LookupIPAddr,
+	}
+
+	schemes := cfg.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	for _, scheme := range schemes {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); len(scheme) > 0 {
+			p.schemes[scheme] = struct{}{}
+		}
+	}
+
+	switch strings.ToLower(cfg.DomainListMode) {
+	case "", ModeBlock:
+	case ModeAllow:
+		p.mode = ModeAllow
+	default:
+		return nil, errors.New("domain list mode must be block or allow")
+	}
+	if len(cfg.DomainListFile) > 0 {
+		if err := p.loadDomains(cfg.DomainListFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.BaseURL) > 0 {
+		base, err := url.Parse(cfg.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		if host := normalizeHost(base.Hostname()); len(host) > 0 {
+			p.selfHosts[host] = struct{}{}
+		}
+	}
+	for _, host := range cfg.Shorteners {
+		if host = normalizeHost(host); len(host) > 0 {
+			p.shorteners[host] = struct{}{}
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Policy) loadDomains(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.domains[normalizeHost(line)] = struct{}{}
+	}
+	return scan.Err()
+}
+
+// Check return one of policy errors when link must not be stored.
+// Host is resolved within ctx, error of ctx is returned when it is done before answer
+func (p *Policy) Check(ctx context.Context, link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := p.schemes[strings.ToLower(u.Scheme)]; !ok {
+		return ErrScheme
+	}
+
+	host := normalizeHost(u.Hostname())
+	if matchDomain(p.selfHosts, host) {
+		return ErrSelfReference
+	}
+	if matchDomain(p.shorteners, host) {
+		return ErrNestedShortLink
+	}
+
+	listed := matchDomain(p.domains, host)
+	if p.mode == ModeBlock && listed {
+		return ErrDomainBlocked
+	}
+	if p.mode == ModeAllow && !listed {
+		return ErrDomainNotListed
+	}
+
+	if !p.allowPrivate {
+		return p.checkAddress(ctx, host)
+	}
+	return nil
+}
+
+func (p *Policy) checkAddress(ctx context.Context, host string) error {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip := parseIP(host); ip != nil {
+		if isPrivateIP(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+	if !p.resolveHosts || len(host) == 0 {
+		return nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := p.lookup(lookupCtx, host)
+	if err != nil {
+		if ctx.Err() != nil {
+			// caller is gone, so waiting for answer makes no sense
+			return ctx.Err()
+		}
+		// host which can not be resolved is not a threat for internal network
+		return nil
+	}
+	for _, addr := range addrs {
+		if isPrivateIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// parseIP parse ip literal of host. Besides usual forms it accepts forms of inet_aton,
+// which browsers and http clients resolve too: 2130706433, 0x7f.1, 0177.0.0.1, 127.1
+func parseIP(host string) net.IP {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return ip
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	var addr uint64
+	for i, part := range parts {
+		n, ok := parseInetPart(part)
+		if !ok {
+			return nil
+		}
+		// the last part fills all remaining bytes of address
+		bits := uint(8)
+		if i == len(parts)-1 {
+			bits = uint(8 * (4 - i))
+		}
+		if n >= 1<<bits {
+			return nil
+		}
+		addr = addr<<bits | n
+	}
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
+
+// parseInetPart parse decimal, 0x hex or 0 octal number of inet_aton
+func parseInetPart(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(part) > 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		base, part = 16, part[2:]
+	case len(part) > 1 && part[0] == '0':
+		base, part = 8, part[1:]
+	}
+	if len(part) == 0 || strings.ContainsAny(part, "+-_") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(part, base, 32)
+	return n, err == nil
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() || cgnatNet.Contains(ip)
+}
+
+// matchDomain check host or one of its parent domains is in set
+func matchDomain(set map[string]struct{}, host string) bool {
+	for len(host) > 0 {
+		if _, ok := set[host]; ok {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+	return false
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	listFile := filepath.Join(t.TempDir(), "domains.txt")
+	assert.NoError(t, os.WriteFile(listFile, []byte("# blocked\nevil.com\n"), 0600))
+
+	p, err := New(Config{
+		DomainListFile: listFile,
+		BaseURL:        "http://short.ru:8080",
+		Shorteners:     DefaultShorteners,
+		ResolveHosts:   true,
+	})
+	assert.NoError(t, err, "Ошибка создания политики")
+	p.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host == "intranet.example.com" || host == "evil-rebind.example" {
+			return []net.IPAddr{{IP: net.ParseIP("10.1.2.3")}}, nil
+		}
+		return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+	}
+
+	testCases := []struct {
+		url      string
+		err      error
+		testName string
+	}{
+		{url: "https://example.com/a", err: nil, testName: "good"},
+		{url: "javascript:alert(1)", err: ErrScheme, testName: "javascript scheme"},
+		{url: "file:///etc/passwd", err: ErrScheme, testName: "file scheme"},
+		{url: "http://sub.evil.com/", err: ErrDomainBlocked, testName: "blocked subdomain"},
+		{url: "http://127.0.0.1/", err: ErrPrivateAddress, testName: "loopback"},
+		{url: "http://[::1]/", err: ErrPrivateAddress, testName: "loopback v6"},
+		{url: "http://169.254.169.254/latest", err: ErrPrivateAddress, testName: "link local"},
+		{url: "http://192.168.1.1/", err: ErrPrivateAddress, testName: "private"},
+		{url: "http://localhost/", err: ErrPrivateAddress, testName: "localhost"},
+		{url: "http://2130706433/", err: ErrPrivateAddress, testName: "decimal loopback"},
+		{url: "http://0x7f.1/", err: ErrPrivateAddress, testName: "hex short loopback"},
+		{url: "http://0x7F000001/", err: ErrPrivateAddress, testName: "hex loopback"},
+		{url: "http://0177.0.0.1/", err: ErrPrivateAddress, testName: "octal loopback"},
+		{url: "http://127.1/", err: ErrPrivateAddress, testName: "short loopback"},
+		{url: "http://10.1/", err: ErrPrivateAddress, testName: "short private"},
+		{url: "http://192.168.257/", err: ErrPrivateAddress, testName: "three parts private"},
+		{url: "http://0/", err: ErrPrivateAddress, testName: "zero address"},
+		{url: "http://[::ffff:127.0.0.1]/", err: ErrPrivateAddress, testName: "mapped loopback"},
+		{url: "http://1.2.3.4.5/", err: nil, testName: "not inet address"},
+		{url: "http://0x100000000/", err: nil, testName: "overflow is host name"},
+		{url: "http://1597463007/", err: nil, testName: "decimal public"},
+		{url: "http://intranet.example.com/", err: ErrPrivateAddress, testName: "resolved to private"},
+		{url: "http://evil-rebind.example./", err: ErrPrivateAddress, testName: "resolved to private with root dot"},
+		{url: "http://short.ru/abc", err: ErrSelfReference, testName: "self reference"},
+		{url: "https://bit.ly/abc", err: ErrNestedShortLink, testName: "nested short link"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.ErrorIs(t, p.Check(context.Background(), tc.url), tc.err, "Результат проверки не совпадает")
+			if tc.err == nil {
+				assert.NoError(t, p.Check(context.Background(), tc.url), "Лишняя ошибка")
+			}
+		})
+	}
+
+	noResolve, err := New(Config{})
+	assert.NoError(t, err, "Ошибка создания политики")
+	assert.ErrorIs(t, noResolve.Check(context.Background(), "http://0x7f.0.0.1/"), ErrPrivateAddress, "Литералы ip проверяются без резолва")
+
+	allow, err := New(Config{DomainListFile: listFile, DomainListMode: ModeAllow})
+	assert.NoError(t, err, "Ошибка создания политики")
+	assert.NoError(t, allow.Check(context.Background(), "https://evil.com/"), "Домен из списка не пропущен")
+	assert.ErrorIs(t, allow.Check(context.Background(), "https://example.com/"), ErrDomainNotListed, "Домен вне списка пропущен")
+}
+
+func TestPolicyCheckContext(t *testing.T) {
+	p, err := New(Config{ResolveHosts: true})
+	assert.NoError(t, err, "Ошибка создания политики")
+	p.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, p.Check(ctx, "https://example.com/"), context.Canceled, "Резолв должен прерываться вместе с запросом")
+
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+	assert.ErrorIs(t, p.Check(deadline, "https://example.com/"), context.DeadlineExceeded, "Таймаут запроса ограничивает резолв")
+}
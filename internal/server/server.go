@@ -2,26 +2,81 @@
 package server
 
 import (
-	"github.com/go-chi/render"
+	"encoding/json"
 	"net/http"
+
+	"github.com/go-chi/render"
 )
 
 //--
 // Error response payloads & renderers
 //--
 
+// ProblemContentType is media type of error responses, see RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// Application error codes, they are part of API and must not be changed
+const (
+	CodeInvalidRequest int64 = 1000 + iota
+	CodeInvalidURL
+	CodeConflict
+	CodeNotFound
+	CodeGone
+	CodeUnauthorized
+	CodeForbidden
+	CodeStorageFailure
+	CodePayloadTooLarge
+	CodeInternal
+	CodeSchemeNotAllowed
+	CodeDomainBlocked
+	CodeDomainNotAllowed
+	CodePrivateAddress
+	CodeSelfReference
+	CodeNestedShortLink
+	CodeUserBlocked
+	CodeRateLimited
+	CodeQuotaExceeded
+)
+
+// problemTypes give every application code stable problem type uri
+var problemTypes = map[int64]string{
+	CodeInvalidRequest:   "/problems/invalid-request",
+	CodeInvalidURL:       "/problems/invalid-url",
+	CodeConflict:         "/problems/conflict",
+	CodeNotFound:         "/problems/not-found",
+	CodeGone:             "/problems/gone",
+	CodeUnauthorized:     "/problems/unauthorized",
+	CodeForbidden:        "/problems/forbidden",
+	CodeStorageFailure:   "/problems/storage-failure",
+	CodePayloadTooLarge:  "/problems/payload-too-large",
+	CodeInternal:         "/problems/internal",
+	CodeSchemeNotAllowed: "/problems/scheme-not-allowed",
+	CodeDomainBlocked:    "/problems/domain-blocked",
+	CodeDomainNotAllowed: "/problems/domain-not-allowed",
+	CodePrivateAddress:   "/problems/private-address",
+	CodeSelfReference:    "/problems/self-reference",
+	CodeNestedShortLink:  "/problems/nested-short-link",
+	CodeUserBlocked:      "/problems/user-blocked",
+	CodeRateLimited:      "/problems/rate-limited",
+	CodeQuotaExceeded:    "/problems/quota-exceeded",
+}
+
 // ErrResponse renderer type for handling all sorts of errors.
 //
-// In the best case scenario, the excellent github.com/pkg/errors package
-// helps reveal information on the error, setting it on Err, and in the Render()
-// method, using it to set the application-specific error code in AppCode.
+// It is written as RFC 7807 problem details: type and code identify the error
+// for clients, title is short human-readable summary, detail explains this occurrence.
 type ErrResponse struct {
-	Err            error `json:"-"` // low-level runtime error
-	HTTPStatusCode int   `json:"-"` // http response status code
+	Err            error `json:"-"`      // low-level runtime error
+	HTTPStatusCode int   `json:"status"` // http response status code
+
+	Type       string `json:"type"`               // problem type uri
+	StatusText string `json:"title"`              // user-level status message
+	AppCode    int64  `json:"code,omitempty"`     // application-specific error code
+	ErrorText  string `json:"detail,omitempty"`   // application-level error message, for debugging
+	Instance   string `json:"instance,omitempty"` // request path, where error occurred
 
-	StatusText string `json:"status"`          // user-level status message
-	AppCode    int64  `json:"code,omitempty"`  // application-specific error code
-	ErrorText  string `json:"error,omitempty"` // application-level error message, for debugging
+	// Result is extension member of conflict, it is existing short link, the same field as in models.URLDataResponse
+	Result string `json:"result,omitempty"`
 }
 
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
@@ -29,22 +84,118 @@ func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func ErrInvalidRequest(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 400,
-		StatusText:     "Invalid request.",
-		ErrorText:      err.Error(),
+// Render is render.Render for error responses, ErrResponse is written as problem json by Respond.
+// Global render.Respond is not changed, so other users of render keep default responder
+func Render(w http.ResponseWriter, r *http.Request, v render.Renderer) error {
+	if err := v.Render(w, r); err != nil {
+		return err
 	}
+	Respond(w, r, v)
+	return nil
 }
 
-func ErrRender(err error) render.Renderer {
+// Respond write ErrResponse as problem json and pass all other values to render.DefaultResponder
+func Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	e, ok := v.(*ErrResponse)
+	if !ok {
+		render.DefaultResponder(w, r, v)
+		return
+	}
+
+	// shared errors like ErrNotFound are copied, instance belongs to one request
+	problem := *e
+	problem.Instance = r.URL.Path
+	if len(problem.Type) == 0 {
+		problem.Type = problemTypes[problem.AppCode]
+	}
+	if len(problem.Type) == 0 {
+		problem.Type = "about:blank"
+	}
+	data, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.HTTPStatusCode)
+	_, _ = w.Write(data)
+}
+
+func newErr(status int, code int64, err error, detail string) *ErrResponse {
+	if len(detail) == 0 && err != nil {
+		detail = err.Error()
+	}
 	return &ErrResponse{
 		Err:            err,
-		HTTPStatusCode: 422,
-		StatusText:     "Error rendering response.",
-		ErrorText:      err.Error(),
+		HTTPStatusCode: status,
+		StatusText:     http.StatusText(status),
+		AppCode:        code,
+		ErrorText:      detail,
 	}
 }
 
-var ErrNotFound = &ErrResponse{HTTPStatusCode: 404, StatusText: "Resource not found."}
+func ErrInvalidRequest(err error) render.Renderer {
+	e := newErr(http.StatusBadRequest, CodeInvalidRequest, err, "")
+	e.StatusText = "Invalid request."
+	return e
+}
+
+// ErrInvalidURL is returned when url from request fails validation
+func ErrInvalidURL(err error) render.Renderer {
+	e := newErr(http.StatusBadRequest, CodeInvalidURL, err, "")
+	e.StatusText = "Invalid URL."
+	return e
+}
+
+// ErrPolicy is returned when url is rejected by destination policy, code tells the reason
+func ErrPolicy(code int64, err error) render.Renderer {
+	e := newErr(http.StatusBadRequest, code, err, "")
+	e.StatusText = "URL is rejected by policy."
+	return e
+}
+
+// ErrConflict is returned when resource already exists, detail can contain existing short link
+func ErrConflict(detail string) render.Renderer {
+	return newErr(http.StatusConflict, CodeConflict, nil, detail)
+}
+
+// ErrURLConflict is returned when url is already shortened, existing short link is in result member
+func ErrURLConflict(shortURL string) render.Renderer {
+	e := newErr(http.StatusConflict, CodeConflict, nil, "url is already shortened as "+shortURL)
+	e.StatusText = "URL is already shortened."
+	e.Result = shortURL
+	return e
+}
+
+// ErrStorage hide storage error from client, err is kept only for logs
+func ErrStorage(err error) render.Renderer {
+	return newErr(http.StatusInternalServerError, CodeStorageFailure, err, "storage failure")
+}
+
+// ErrAudit is returned when admin action is not written to audit log, the action itself may be done
+func ErrAudit(err error) render.Renderer {
+	return newErr(http.StatusInternalServerError, CodeStorageFailure, err, "action is not written to audit log, check its result before repeat")
+}
+
+func ErrInternal(err error) render.Renderer {
+	return newErr(http.StatusInternalServerError, CodeInternal, err, "internal error")
+}
+
+func ErrRender(err error) render.Renderer {
+	e := newErr(http.StatusUnprocessableEntity, CodeInternal, err, "")
+	e.StatusText = "Error rendering response."
+	return e
+}
+
+var (
+	ErrNotFound        = &ErrResponse{HTTPStatusCode: http.StatusNotFound, StatusText: "Resource not found.", AppCode: CodeNotFound}
+	ErrGone            = &ErrResponse{HTTPStatusCode: http.StatusGone, StatusText: "Resource is deleted or expired.", AppCode: CodeGone}
+	ErrUnauthorized    = &ErrResponse{HTTPStatusCode: http.StatusUnauthorized, StatusText: "Unauthorized.", AppCode: CodeUnauthorized}
+	ErrForbidden       = &ErrResponse{HTTPStatusCode: http.StatusForbidden, StatusText: "Forbidden.", AppCode: CodeForbidden}
+	ErrPayloadTooLarge = &ErrResponse{HTTPStatusCode: http.StatusRequestEntityTooLarge, StatusText: "Payload too large.", AppCode: CodePayloadTooLarge}
+	ErrUserBlocked     = &ErrResponse{HTTPStatusCode: http.StatusForbidden, StatusText: "User is blocked from creating links.", AppCode: CodeUserBlocked}
+	ErrTooManyRequests = &ErrResponse{HTTPStatusCode: http.StatusTooManyRequests, StatusText: "Too many requests.", AppCode: CodeRateLimited}
+	ErrQuotaExceeded   = &ErrResponse{HTTPStatusCode: http.StatusForbidden, StatusText: "Link quota exceeded.", AppCode: CodeQuotaExceeded}
+)
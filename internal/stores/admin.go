@@ -0,0 +1,241 @@
+// Package stores contain queries and function to use them
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/models"
+)
+
+var ErrUserBlocked = errors.New("user is blocked from creating links")
+
+// SetRedirectDeleted disable or restore redirect of any user, it is used by admins
+func (u *URLStore) SetRedirectDeleted(ctx context.Context, slug string, deleted bool) (redirect models.Redirect, err error) {
+	ctx, op := u.begin(ctx, "SetRedirectDeleted")
+	defer op.end(&err)
+	isDelete := 0
+	if deleted {
+		isDelete = 1
+	}
+
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, SetRedirectDeleted)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("SetRedirectDeleted get connection failure")
+			return redirect, err
+		}
+		defer conn.Close()
+
+		res, err := conn.ExecContext(ctx, sqlRequest, slug, strconv.Itoa(isDelete))
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("data", slug).Msg("SetRedirectDeleted exec failure")
+			return redirect, err
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+			return redirect, ErrRedirectNotFound
+		}
+
+		redirect, err = u.GetRedirect(ctx, slug)
+		if err != nil {
+			return redirect, err
+		}
+	}
+
+	// memory store is used as cache in db mode too, so it must be updated in both modes
+	u.Mu.Lock()
+	cached, ok := u.EmulateDB[slug]
+	if u.DisableDB != "0" {
+		if !ok || cached.Redirect != slug {
+			u.Mu.Unlock()
+			return redirect, ErrRedirectNotFound
+		}
+		redirect = cached
+		redirect.IsDelete = isDelete
+		redirect.DateUpdate = time.Now().String()
+	}
+	if ok {
+		redirect.CanonicalURL = cached.CanonicalURL
+		u.EmulateDB[slug] = redirect
+		if u.EmulateDB[cached.URLKey()].Redirect == slug {
+			u.EmulateDB[cached.URLKey()] = redirect
+		}
+	}
+	u.Mu.Unlock()
+
+	dataFile, _ := json.Marshal(redirect)
+	_ = u.StoreToFile(ctx, string(dataFile)+"\n")
+
+	return redirect, nil
+}
+
+// BlockUser forbid user to create new links, blocking of blocked user is not an error
+func (u *URLStore) BlockUser(ctx context.Context, blocked models.BlockedUser) (err error) {
+	ctx, op := u.begin(ctx, "BlockUser")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, BlockUser)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("BlockUser get connection failure")
+			return err
+		}
+		defer conn.Close()
+
+		_, err = conn.ExecContext(ctx, sqlRequest, blocked.UserID, blocked.Admin, blocked.Reason, blocked.DateCreate)
+		return err
+	}
+
+	u.Mu.Lock()
+	_, exists := u.EmulateBlockedUsers[blocked.UserID]
+	if !exists {
+		u.EmulateBlockedUsers[blocked.UserID] = blocked
+	}
+	u.Mu.Unlock()
+	if exists {
+		return nil
+	}
+	return u.storeRecord(ctx, fileRecord{Kind: fileKindBlock, Blocked: &blocked})
+}
+
+func (u *URLStore) UnblockUser(ctx context.Context, userID string) (err error) {
+	ctx, op := u.begin(ctx, "UnblockUser")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, UnblockUser)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("UnblockUser get connection failure")
+			return err
+		}
+		defer conn.Close()
+
+		_, err = conn.ExecContext(ctx, sqlRequest, userID)
+		return err
+	}
+
+	u.Mu.Lock()
+	delete(u.EmulateBlockedUsers, userID)
+	u.Mu.Unlock()
+	return u.storeRecord(ctx, fileRecord{Kind: fileKindUnblock, UserID: userID})
+}
+
+func (u *URLStore) IsUserBlocked(ctx context.Context, userID string) (blocked bool, err error) {
+	ctx, op := u.begin(ctx, "IsUserBlocked")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, IsUserBlocked)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("IsUserBlocked get connection failure")
+			return blocked, err
+		}
+		defer conn.Close()
+
+		err = conn.QueryRowContext(ctx, sqlRequest, userID).Scan(&blocked)
+		return blocked, err
+	}
+
+	u.Mu.RLock()
+	_, blocked = u.EmulateBlockedUsers[userID]
+	u.Mu.RUnlock()
+	return blocked, nil
+}
+
+// NewAuditRecord save admin action, record is written to log too, so it is not lost when store fails
+func (u *URLStore) NewAuditRecord(ctx context.Context, record models.AuditRecord) (err error) {
+	ctx, op := u.begin(ctx, "NewAuditRecord")
+	defer op.end(&err)
+	logging.FromContext(ctx).Info().
+		Str("admin", record.Admin).
+		Str("action", record.Action).
+		Str("target", record.Target).
+		Str("detail", record.Detail).
+		Str("outcome", record.Outcome).
+		Int("status", record.Status).
+		Msg("admin action")
+
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, InsertAuditRecord)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("NewAuditRecord get connection failure")
+			return err
+		}
+		defer conn.Close()
+
+		_, err = conn.ExecContext(ctx, sqlRequest, record.ID, record.Admin, record.Action, record.Target, record.Detail, record.Outcome, record.Status, record.DateCreate)
+		return err
+	}
+
+	u.Mu.Lock()
+	u.EmulateAudit = append(u.EmulateAudit, record)
+	u.Mu.Unlock()
+	return u.storeRecord(ctx, fileRecord{Kind: fileKindAudit, Audit: &record})
+}
+
+// GetAuditRecords return last admin actions, newer records go first
+func (u *URLStore) GetAuditRecords(ctx context.Context, limit int) (records []models.AuditRecord, err error) {
+	ctx, op := u.begin(ctx, "GetAuditRecords")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, GetAuditRecords)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("GetAuditRecords get connection failure")
+			return records, err
+		}
+		defer conn.Close()
+
+		row, err := conn.QueryContext(ctx, sqlRequest, limit)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("GetAuditRecords exec failure")
+			return records, err
+		}
+		defer row.Close()
+
+		for row.Next() {
+			var record models.AuditRecord
+			if err := row.Scan(
+				&record.ID,
+				&record.Admin,
+				&record.Action,
+				&record.Target,
+				&record.Detail,
+				&record.Outcome,
+				&record.Status,
+				&record.DateCreate,
+			); err != nil {
+				logging.FromContext(ctx).Error().Err(err).Msg("scan failure")
+				return records, err
+			}
+			records = append(records, record)
+		}
+		return records, row.Err()
+	}
+
+	// records are appended in order of actions
+	u.Mu.RLock()
+	for i := len(u.EmulateAudit) - 1; i >= 0 && len(records) < limit; i-- {
+		records = append(records, u.EmulateAudit[i])
+	}
+	u.Mu.RUnlock()
+	return records, nil
+}
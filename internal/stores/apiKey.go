@@ -0,0 +1,220 @@
+// Package stores contain queries and function to use them
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/models"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// NewAPIKey store key, key.Hash must be filled, key itself is never stored
+func (u *URLStore) NewAPIKey(ctx context.Context, key models.APIKey) (err error) {
+	ctx, op := u.begin(ctx, "NewAPIKey")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, InsertAPIKey)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("NewAPIKey get connection failure")
+			return err
+		}
+		defer conn.Close()
+
+		_, err = conn.ExecContext(ctx, sqlRequest, key.ID, key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Scopes), key.DateCreate)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("id", key.ID).Msg("NewAPIKey exec failure")
+		}
+		return err
+	}
+
+	u.Mu.Lock()
+	u.EmulateAPIKeys[key.Hash] = key
+	u.Mu.Unlock()
+	return u.storeRecord(ctx, fileRecord{Kind: fileKindAPIKey, APIKey: newFileAPIKey(key)})
+}
+
+// GetAPIKeysByUser return not revoked keys of user, older keys go first
+func (u *URLStore) GetAPIKeysByUser(ctx context.Context, userID string) (keys []models.APIKey, err error) {
+	ctx, op := u.begin(ctx, "GetAPIKeysByUser")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, GetAPIKeysByUser)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("GetAPIKeysByUser get connection failure")
+			return keys, err
+		}
+		defer conn.Close()
+
+		row, err := conn.QueryContext(ctx, sqlRequest, userID)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("user", userID).Msg("GetAPIKeysByUser exec failure")
+			return keys, err
+		}
+		defer row.Close()
+
+		for row.Next() {
+			key, err := scanAPIKey(row)
+			if err != nil {
+				logging.FromContext(ctx).Error().Err(err).Msg("scan failure")
+				return keys, err
+			}
+			keys = append(keys, key)
+		}
+		return keys, row.Err()
+	}
+
+	u.Mu.RLock()
+	for _, key := range u.EmulateAPIKeys {
+		if key.UserID == userID && !key.Revoked {
+			keys = append(keys, key)
+		}
+	}
+	u.Mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].DateCreate.Before(keys[j].DateCreate)
+	})
+	return keys, nil
+}
+
+// GetAPIKeyByHash search not revoked key, ErrAPIKeyNotFound is returned for unknown and revoked keys
+func (u *URLStore) GetAPIKeyByHash(ctx context.Context, hash string) (key models.APIKey, err error) {
+	ctx, op := u.begin(ctx, "GetAPIKeyByHash")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, GetAPIKeyByHash)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("GetAPIKeyByHash get connection failure")
+			return key, err
+		}
+		defer conn.Close()
+
+		row, err := conn.QueryContext(ctx, sqlRequest, hash)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("GetAPIKeyByHash exec failure")
+			return key, err
+		}
+		defer row.Close()
+
+		if !row.Next() {
+			if err = row.Err(); err != nil {
+				return key, err
+			}
+			return key, ErrAPIKeyNotFound
+		}
+		return scanAPIKey(row)
+	}
+
+	u.Mu.RLock()
+	key, ok := u.EmulateAPIKeys[hash]
+	u.Mu.RUnlock()
+	if !ok || key.Revoked {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// RevokeAPIKey disable key of user, ErrAPIKeyNotFound is returned when user has no such key
+func (u *URLStore) RevokeAPIKey(ctx context.Context, id string, userID string) (err error) {
+	ctx, op := u.begin(ctx, "RevokeAPIKey")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, RevokeAPIKey)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("RevokeAPIKey get connection failure")
+			return err
+		}
+		defer conn.Close()
+
+		res, err := conn.ExecContext(ctx, sqlRequest, id, userID)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("id", id).Msg("RevokeAPIKey exec failure")
+			return err
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+			return ErrAPIKeyNotFound
+		}
+		return nil
+	}
+
+	u.Mu.Lock()
+	for hash, key := range u.EmulateAPIKeys {
+		if key.ID == id && key.UserID == userID && !key.Revoked {
+			key.Revoked = true
+			u.EmulateAPIKeys[hash] = key
+			u.Mu.Unlock()
+			return u.storeRecord(ctx, fileRecord{Kind: fileKindAPIKey, APIKey: newFileAPIKey(key)})
+		}
+	}
+	u.Mu.Unlock()
+	return ErrAPIKeyNotFound
+}
+
+// TouchAPIKey save time of last key usage
+func (u *URLStore) TouchAPIKey(ctx context.Context, key models.APIKey, used time.Time) (err error) {
+	ctx, op := u.begin(ctx, "TouchAPIKey")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, TouchAPIKey)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("TouchAPIKey get connection failure")
+			return err
+		}
+		defer conn.Close()
+
+		_, err = conn.ExecContext(ctx, sqlRequest, key.ID, used)
+		return err
+	}
+
+	u.Mu.Lock()
+	stored, ok := u.EmulateAPIKeys[key.Hash]
+	if ok {
+		stored.LastUsed = &used
+		u.EmulateAPIKeys[key.Hash] = stored
+	}
+	u.Mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return u.storeRecord(ctx, fileRecord{Kind: fileKindAPIKey, APIKey: newFileAPIKey(stored)})
+}
+
+func scanAPIKey(row *sql.Rows) (key models.APIKey, err error) {
+	var lastUsed sql.NullTime
+	err = row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.Hash,
+		pq.Array(&key.Scopes),
+		&key.DateCreate,
+		&lastUsed,
+	)
+	if lastUsed.Valid {
+		key.LastUsed = &lastUsed.Time
+	}
+	return key, err
+}
@@ -0,0 +1,84 @@
+// Package stores contain queries and function to use them
+package stores
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Aligator77/go_practice/internal/models"
+)
+
+// kinds of file store lines, which are not redirects
+const (
+	fileKindAPIKey  = "api_key"
+	fileKindBlock   = "block"
+	fileKindUnblock = "unblock"
+	fileKindAudit   = "audit"
+	fileKindQuota   = "quota"
+)
+
+// fileRecord is line of file store with data of users and admins, it keeps them when db is disabled.
+// Lines of redirects have no kind, so files written before are read as is
+type fileRecord struct {
+	Kind    string                `json:"kind"`
+	UserID  string                `json:"user_id,omitempty"`
+	APIKey  *fileAPIKey           `json:"api_key,omitempty"`
+	Blocked *models.BlockedUser   `json:"blocked,omitempty"`
+	Audit   *models.AuditRecord   `json:"audit,omitempty"`
+	Quota   *models.QuotaOverride `json:"quota,omitempty"`
+}
+
+// fileAPIKey add fields of key hidden from api responses
+type fileAPIKey struct {
+	models.APIKey
+	UserID  string `json:"user_id"`
+	Hash    string `json:"hash"`
+	Revoked bool   `json:"revoked"`
+}
+
+func newFileAPIKey(key models.APIKey) *fileAPIKey {
+	return &fileAPIKey{APIKey: key, UserID: key.UserID, Hash: key.Hash, Revoked: key.Revoked}
+}
+
+func (k fileAPIKey) key() models.APIKey {
+	key := k.APIKey
+	key.UserID, key.Hash, key.Revoked = k.UserID, k.Hash, k.Revoked
+	return key
+}
+
+// storeRecord append record to file store, it does nothing when file store is disabled
+func (u *URLStore) storeRecord(ctx context.Context, record fileRecord) error {
+	if len(u.LocalStore) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return u.StoreToFile(ctx, string(data)+"\n")
+}
+
+// restoreRecord apply record read from file store, caller must hold u.Mu
+func (u *URLStore) restoreRecord(record fileRecord) {
+	switch record.Kind {
+	case fileKindAPIKey:
+		if record.APIKey != nil {
+			key := record.APIKey.key()
+			u.EmulateAPIKeys[key.Hash] = key
+		}
+	case fileKindBlock:
+		if record.Blocked != nil {
+			u.EmulateBlockedUsers[record.Blocked.UserID] = *record.Blocked
+		}
+	case fileKindUnblock:
+		delete(u.EmulateBlockedUsers, record.UserID)
+	case fileKindAudit:
+		if record.Audit != nil {
+			u.EmulateAudit = append(u.EmulateAudit, *record.Audit)
+		}
+	case fileKindQuota:
+		if record.Quota != nil {
+			u.EmulateQuotas[record.UserID] = *record.Quota
+		}
+	}
+}
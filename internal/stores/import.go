@@ -0,0 +1,264 @@
+// Package stores contain queries and function to use them
+package stores
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/Aligator77/go_practice/internal/helpers"
+	"github.com/Aligator77/go_practice/internal/models"
+)
+
+const (
+	ImportFormatCSV   = "csv"
+	ImportFormatJSONL = "jsonl"
+
+	// ImportMaxLineSize limit one line of jsonl file, so bad file can not eat memory
+	ImportMaxLineSize = 64 * 1024
+	ImportMaxRows     = 100000
+)
+
+var ErrImportFormat = errors.New("import format must be csv or jsonl")
+
+// ImportReader read rows of imported file one by one, io.EOF returned at the end of file.
+// Error of one row is returned together with row number, so reading can go on.
+type ImportReader interface {
+	Next() (line int, row models.URLImportRow, err error)
+}
+
+// NewImportReader create reader for csv or jsonl format
+func NewImportReader(format string, r io.Reader) (ImportReader, error) {
+	switch format {
+	case ImportFormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		reader.ReuseRecord = true
+		return &csvImportReader{reader: reader, columns: []string{"original_url", "alias", "expires_at"}}, nil
+	case ImportFormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 4096), ImportMaxLineSize)
+		return &jsonlImportReader{scanner: scanner}, nil
+	}
+	return nil, ErrImportFormat
+}
+
+// csvImportReader read columns by header, without header columns are original_url, alias, expires_at
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns []string
+	line    int
+}
+
+func (c *csvImportReader) Next() (line int, row models.URLImportRow, err error) {
+	record, err := c.reader.Read()
+	c.line++
+	if err != nil {
+		return c.line, row, err
+	}
+
+	if c.line == 1 && isImportHeader(record) {
+		c.columns = make([]string, len(record))
+		for i, column := range record {
+			c.columns[i] = strings.ToLower(strings.TrimSpace(column))
+		}
+		return c.Next()
+	}
+
+	for i, value := range record {
+		if i >= len(c.columns) {
+			break
+		}
+		value = strings.TrimSpace(value)
+		switch c.columns[i] {
+		case "original_url":
+			row.OriginalURL = value
+		case "alias":
+			row.Alias = value
+		case "expires_at":
+			row.ExpiresAt = value
+		}
+	}
+	return c.line, row, nil
+}
+
+func isImportHeader(record []string) bool {
+	for _, column := range record {
+		if strings.EqualFold(strings.TrimSpace(column), "original_url") {
+			return true
+		}
+	}
+	return false
+}
+
+type jsonlImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (j *jsonlImportReader) Next() (line int, row models.URLImportRow, err error) {
+	for j.scanner.Scan() {
+		j.line++
+		data := j.scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		err = json.Unmarshal(data, &row)
+		return j.line, row, err
+	}
+	if err = j.scanner.Err(); err != nil {
+		return j.line + 1, row, err
+	}
+	return j.line, row, io.EOF
+}
+
+// ImportRedirects create redirects from reader row by row and report result of every row to emit.
+// Only one row is kept in memory. Import stops on reader failure or when emit returns error.
+func (u *URLStore) ImportRedirects(ctx context.Context, reader ImportReader, userID string, maxRows int, emit func(models.URLImportResult) error) (err error) {
+	ctx, op := u.begin(ctx, "ImportRedirects")
+	defer op.end(&err)
+	rows := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			// client is gone, rest of rows is not imported
+			return err
+		}
+		line, row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var parseErr *csv.ParseError
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if err != nil && !errors.As(err, &parseErr) && !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+			// reader can not go on, e.g. too long line
+			_ = emit(models.URLImportResult{Row: line, Status: models.ImportInvalid, Error: err.Error()})
+			return err
+		}
+
+		rows++
+		if rows > maxRows {
+			_ = emit(models.URLImportResult{Row: line, Status: models.ImportInvalid, Error: "too many rows"})
+			return nil
+		}
+
+		var result models.URLImportResult
+		if err != nil {
+			result = models.URLImportResult{Row: line, Status: models.ImportInvalid, Error: err.Error()}
+		} else {
+			result = u.importRow(ctx, row, userID)
+			result.Row = line
+		}
+		if err := emit(result); err != nil {
+			return err
+		}
+	}
+}
+
+func (u *URLStore) importRow(ctx context.Context, row models.URLImportRow, userID string) models.URLImportResult {
+	result := models.URLImportResult{OriginalURL: row.OriginalURL}
+
+	if err := u.ValidateDestination(ctx, row.OriginalURL); err != nil {
+		result.Status = models.ImportInvalid
+		result.Error = "invalid original_url: " + err.Error()
+		return result
+	}
+	if len(row.Alias) > 0 && helpers.IsReservedAlias(row.Alias) {
+		result.Status = models.ImportInvalid
+		result.Error = "alias is reserved"
+		return result
+	}
+	if len(row.Alias) > 0 && !helpers.ValidateAlias(row.Alias) {
+		result.Status = models.ImportInvalid
+		result.Error = "invalid alias"
+		return result
+	}
+	var dateExpire string
+	if len(row.ExpiresAt) > 0 {
+		expire, err := time.Parse(time.RFC3339, row.ExpiresAt)
+		if err != nil || expire.Before(time.Now()) {
+			result.Status = models.ImportInvalid
+			result.Error = "expires_at must be RFC3339 date in future"
+			return result
+		}
+		dateExpire = expire.UTC().Format(time.RFC3339Nano)
+	}
+
+	existRedirect, err := u.GetRedirectByURL(ctx, row.OriginalURL)
+	if err != nil {
+		result.Status = models.ImportFailed
+		result.Error = "storage failure"
+		return result
+	}
+	if len(existRedirect.URL) > 0 {
+		result.Status = models.ImportDuplicate
+		result.ShortURL = u.MakeFullURL(existRedirect.Redirect)
+		return result
+	}
+
+	slug := row.Alias
+	if len(slug) > 0 {
+		existAlias, err := u.GetRedirect(ctx, slug)
+		if err != nil {
+			result.Status = models.ImportFailed
+			result.Error = "storage failure"
+			return result
+		}
+		if existAlias.Redirect == slug {
+			result.Status = models.ImportConflict
+			result.Error = ErrSlugTaken.Error()
+			return result
+		}
+	} else {
+		slug = helpers.GenerateRandomURL(10)
+	}
+
+	newUUID, _ := uuid.NewV7()
+	redirect := models.Redirect{
+		ID:         newUUID.String(),
+		IsDelete:   0,
+		URL:        row.OriginalURL,
+		Redirect:   slug,
+		DateCreate: time.Now().String(),
+		DateUpdate: time.Now().String(),
+		User:       userID,
+		DateExpire: dateExpire,
+	}
+	allowed, unlock, err := u.ReserveLinks(ctx, userID, 1)
+	if err != nil {
+		result.Status = models.ImportFailed
+		result.Error = "storage failure"
+		return result
+	}
+	defer unlock()
+	if allowed < 1 {
+		result.Status = models.ImportFailed
+		result.Error = ErrQuotaExceeded.Error()
+		return result
+	}
+	_, err = u.NewRedirect(ctx, redirect)
+	if errors.Is(err, ErrSlugTaken) {
+		// alias is taken by parallel import after check above
+		result.Status = models.ImportConflict
+		result.Error = err.Error()
+		return result
+	}
+	if err != nil {
+		result.Status = models.ImportFailed
+		result.Error = "storage failure"
+		return result
+	}
+
+	result.Status = models.ImportCreated
+	result.ShortURL = u.MakeFullURL(slug)
+	return result
+}
@@ -3,7 +3,13 @@ package stores
 
 import (
 	"context"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Aligator77/go_practice/internal/tracing"
 )
 
 const (
@@ -13,8 +19,56 @@ const (
 	GetRedirectByURL
 	DisableRedirects   // add for iter15
 	GetRedirectsByUser // add for iter15
+	UpdateRedirect
+	GetRedirectsByUserPage
+	InsertAPIKey
+	GetAPIKeysByUser
+	GetAPIKeyByHash
+	RevokeAPIKey
+	TouchAPIKey
+	SearchRedirects
+	SetRedirectDeleted
+	BlockUser
+	UnblockUser
+	IsUserBlocked
+	InsertAuditRecord
+	GetAuditRecords
+	GetQuotaUsage
+	GetUserQuota
+	SetUserQuota
+	ExportRedirectsByUser
+	LockUserQuota
 )
 
+// queryNames are names of query spans
+var queryNames = [...]string{
+	GetRedirect:            "GetRedirect",
+	InsertRedirect:         "InsertRedirect",
+	InsertBatchRedirects:   "InsertBatchRedirects",
+	GetRedirectByURL:       "GetRedirectByURL",
+	DisableRedirects:       "DisableRedirects",
+	GetRedirectsByUser:     "GetRedirectsByUser",
+	UpdateRedirect:         "UpdateRedirect",
+	GetRedirectsByUserPage: "GetRedirectsByUserPage",
+	InsertAPIKey:           "InsertAPIKey",
+	GetAPIKeysByUser:       "GetAPIKeysByUser",
+	GetAPIKeyByHash:        "GetAPIKeyByHash",
+	RevokeAPIKey:           "RevokeAPIKey",
+	TouchAPIKey:            "TouchAPIKey",
+	SearchRedirects:        "SearchRedirects",
+	SetRedirectDeleted:     "SetRedirectDeleted",
+	BlockUser:              "BlockUser",
+	UnblockUser:            "UnblockUser",
+	IsUserBlocked:          "IsUserBlocked",
+	InsertAuditRecord:      "InsertAuditRecord",
+	GetAuditRecords:        "GetAuditRecords",
+	GetQuotaUsage:          "GetQuotaUsage",
+	GetUserQuota:           "GetUserQuota",
+	SetUserQuota:           "SetUserQuota",
+	ExportRedirectsByUser:  "ExportRedirectsByUser",
+	LockUserQuota:          "LockUserQuota",
+}
+
 type SQLQuery struct {
 	SQLRequest string
 	ctxTimeout time.Duration
@@ -33,8 +87,10 @@ func init() {
 			, redirect
 			, date_create
 			, date_update
-			, user_id)
-			values ($1, $2, $3, $4, NOW(), NOW(), $5)
+			, user_id
+			, date_expire
+			, canonical_url)
+			values ($1, $2, $3, $4, NOW(), NOW(), $5, $6, $7)
 		`,
 		ctxTimeout: 2 * time.Minute}
 	// change is_active to is_deleted for iter15
@@ -48,6 +104,7 @@ func init() {
 			, date_create
 			, date_update
 			, user_id
+			, canonical_url
 			)
 			values
 		`,
@@ -55,12 +112,14 @@ func init() {
 	// change is_active to is_deleted for iter15
 	queryMap[GetRedirect] = SQLQuery{
 		SQLRequest: `
-			select url
+			select id
+			     , url
 			     , redirect
 			     , date_create
 				 , date_update
 				 , is_deleted
 				 , user_id
+				 , coalesce(date_expire::text, '')
 			from redirects
 			where redirect = $1 limit 1
 		`,
@@ -77,16 +136,16 @@ func init() {
 				 , is_deleted
 				 , user_id
 			from redirects
-			where is_deleted = B'0' and url = $1 limit 1
+			where is_deleted = B'0' and (date_expire is null or date_expire > NOW()) and canonical_url = $1 limit 1
 		`,
 		ctxTimeout: 2 * time.Minute,
 	}
 	// add block for iter15
 	queryMap[DisableRedirects] = SQLQuery{
 		SQLRequest: `
-			Update redirects
-			set is_deleted = B'1' 
-			
+			update redirects
+			set is_deleted = B'1'
+			where redirect = any($1) and user_id = $2
 		`,
 		ctxTimeout: 2 * time.Minute,
 	}
@@ -104,13 +163,234 @@ func init() {
 		`,
 		ctxTimeout: 2 * time.Minute,
 	}
+	// export streams all links of user to client, slow client must not cut it by timeout of usual queries
+	queryMap[ExportRedirectsByUser] = SQLQuery{
+		SQLRequest: queryMap[GetRedirectsByUser].SQLRequest,
+		ctxTimeout: 30 * time.Minute,
+	}
 	// end of added block for iter15
+	queryMap[UpdateRedirect] = SQLQuery{
+		SQLRequest: `
+			update redirects
+			set url = $1
+			  , canonical_url = $4
+			  , date_update = NOW()
+			where redirect = $2 and user_id = $3 and is_deleted = B'0'
+			  and (date_expire is null or date_expire > NOW())
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	// filters, cursor and order are added in GetRedirectsByUserPage, query use redirects_user_id_date_create_index,
+	// substring filter of url use redirects_url_trgm_index
+	queryMap[GetRedirectsByUserPage] = SQLQuery{
+		SQLRequest: `
+			select id
+			     , url
+			     , redirect
+			     , date_create
+				 , date_update
+				 , is_deleted
+				 , user_id
+			from redirects
+			where user_id = $1
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[InsertAPIKey] = SQLQuery{
+		SQLRequest: `
+			insert into api_keys
+			(id
+			, user_id
+			, name
+			, prefix
+			, key_hash
+			, scopes
+			, date_create)
+			values ($1, $2, $3, $4, $5, $6, $7)
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[GetAPIKeysByUser] = SQLQuery{
+		SQLRequest: `
+			select id
+			     , user_id
+			     , name
+			     , prefix
+			     , key_hash
+			     , scopes
+			     , date_create
+			     , last_used
+			from api_keys
+			where user_id = $1 and date_revoke is null
+			order by date_create
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[GetAPIKeyByHash] = SQLQuery{
+		SQLRequest: `
+			select id
+			     , user_id
+			     , name
+			     , prefix
+			     , key_hash
+			     , scopes
+			     , date_create
+			     , last_used
+			from api_keys
+			where key_hash = $1 and date_revoke is null limit 1
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[RevokeAPIKey] = SQLQuery{
+		SQLRequest: `
+			update api_keys
+			set date_revoke = NOW()
+			where id = $1 and user_id = $2 and date_revoke is null
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[TouchAPIKey] = SQLQuery{
+		SQLRequest: `
+			update api_keys
+			set last_used = $2
+			where id = $1
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	// filters, cursor and order are added in SearchRedirects like in GetRedirectsByUserPage
+	queryMap[SearchRedirects] = SQLQuery{
+		SQLRequest: `
+			select id
+			     , url
+			     , redirect
+			     , date_create
+				 , date_update
+				 , is_deleted
+				 , user_id
+			from redirects
+			where true
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[SetRedirectDeleted] = SQLQuery{
+		SQLRequest: `
+			update redirects
+			set is_deleted = $2::bit(1)
+			  , date_update = NOW()
+			where redirect = $1
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[BlockUser] = SQLQuery{
+		SQLRequest: `
+			insert into blocked_users
+			(user_id
+			, admin
+			, reason
+			, date_create)
+			values ($1, $2, $3, $4)
+			on conflict (user_id) do nothing
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[UnblockUser] = SQLQuery{
+		SQLRequest: `
+			delete from blocked_users
+			where user_id = $1
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[IsUserBlocked] = SQLQuery{
+		SQLRequest: `
+			select exists(select 1 from blocked_users where user_id = $1)
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[InsertAuditRecord] = SQLQuery{
+		SQLRequest: `
+			insert into admin_audit
+			(id
+			, admin
+			, action
+			, target
+			, detail
+			, outcome
+			, status
+			, date_create)
+			values ($1, $2, $3, $4, $5, $6, $7, $8)
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[GetAuditRecords] = SQLQuery{
+		SQLRequest: `
+			select id
+			     , admin
+			     , action
+			     , target
+			     , detail
+			     , outcome
+			     , status
+			     , date_create
+			from admin_audit
+			order by date_create desc, id desc
+			limit $1
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	// live links are not deleted and not expired, daily links are counted with deleted ones
+	queryMap[GetQuotaUsage] = SQLQuery{
+		SQLRequest: `
+			select count(*) filter (where is_deleted = B'0' and (date_expire is null or date_expire > NOW()))
+			     -- date_create is local time of session, so UTC day start is converted to it by comparison
+			     , count(*) filter (where date_create >= date_trunc('day', NOW() at time zone 'UTC') at time zone 'UTC')
+			from redirects
+			where user_id = $1
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	// lock is released by end of transaction, it is the same for all replicas
+	queryMap[LockUserQuota] = SQLQuery{
+		SQLRequest: `select pg_advisory_xact_lock(hashtext('quota:' || $1))`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[GetUserQuota] = SQLQuery{
+		SQLRequest: `
+			select max_live_links
+			     , max_daily_links
+			from user_quotas
+			where user_id = $1
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
+	queryMap[SetUserQuota] = SQLQuery{
+		SQLRequest: `
+			insert into user_quotas
+			(user_id
+			, max_live_links
+			, max_daily_links)
+			values ($1, $2, $3)
+			on conflict (user_id) do update
+			set max_live_links = excluded.max_live_links
+			  , max_daily_links = excluded.max_daily_links
+		`,
+		ctxTimeout: 2 * time.Minute,
+	}
 }
 
-func Get(name int) (string, context.Context, context.CancelFunc) {
+// Get return query and context with its timeout. Span of query is child of ctx span, it is ended
+// by cancel. Query is not canceled with ctx, so it is finished even when client has gone
+func Get(ctx context.Context, name int) (string, context.Context, context.CancelFunc) {
 	sqlQuery := queryMap[name]
-	ctx := context.Background()
+	ctx, span := tracing.Start(context.WithoutCancel(ctx), "sql "+queryNames[name],
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.query.text", strings.TrimSpace(sqlQuery.SQLRequest)),
+		))
 	ctx, cancel := context.WithTimeout(ctx, sqlQuery.ctxTimeout)
 
-	return sqlQuery.SQLRequest, ctx, cancel
+	return sqlQuery.SQLRequest, ctx, func() {
+		cancel()
+		span.End()
+	}
 }
@@ -0,0 +1,201 @@
+// Package stores contain queries and function to use them
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/models"
+)
+
+// quotaLockStripes is number of locks shared by users, user always gets the same lock
+const quotaLockStripes = 64
+
+var ErrQuotaExceeded = errors.New("link quota exceeded")
+
+// ReserveLinks lock quota of user and return how many of n links can be created.
+// Lock is held until unlock is called, so links must be stored before it,
+// otherwise parallel requests of user can exceed quota. In db mode lock is advisory lock
+// of transaction, so replicas sharing database wait for each other too.
+// User without quota is not locked
+func (u *URLStore) ReserveLinks(ctx context.Context, userID string, n int) (allowed int, unlock func(), err error) {
+	ctx, op := u.begin(ctx, "ReserveLinks")
+	defer op.end(&err)
+	quota, err := u.GetUserQuota(ctx, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if quota == (models.Quota{}) {
+		return n, func() {}, nil
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+	mu := &u.quotaLocks[h.Sum32()%u.quotaStripes()]
+	mu.Lock()
+
+	if u.DisableDB != "0" {
+		usage, err := u.GetQuotaUsage(ctx, userID)
+		if err != nil {
+			mu.Unlock()
+			return 0, nil, err
+		}
+		return quota.Allowed(usage, n), mu.Unlock, nil
+	}
+
+	// transaction is not bound to request, it lives until caller stores links
+	tx, err := u.DB.DB().BeginTx(context.WithoutCancel(ctx), nil)
+	if err != nil {
+		mu.Unlock()
+		logging.FromContext(ctx).Error().Err(err).Msg("ReserveLinks begin failure")
+		return 0, nil, err
+	}
+	unlock = func() {
+		_ = tx.Rollback()
+		mu.Unlock()
+	}
+	sqlRequest, lockCtx, cancel := Get(ctx, LockUserQuota)
+	_, err = tx.ExecContext(lockCtx, sqlRequest, userID)
+	cancel()
+	if err != nil {
+		unlock()
+		return 0, nil, err
+	}
+	usage, err := u.quotaUsage(ctx, tx, userID)
+	if err != nil {
+		unlock()
+		return 0, nil, err
+	}
+	return quota.Allowed(usage, n), unlock, nil
+}
+
+// quotaStripes return number of used quota locks. Every locked user holds db connection
+// until its links are stored by another one, so half of pool is left for storing
+func (u *URLStore) quotaStripes() uint32 {
+	stripes := uint32(quotaLockStripes)
+	if u.DisableDB == "0" {
+		if maxOpen := u.DB.DB().Stats().MaxOpenConnections; maxOpen > 0 {
+			stripes = min(stripes, uint32(max(1, maxOpen/2)))
+		}
+	}
+	return stripes
+}
+
+// GetUserQuota return global quota with overrides of user
+func (u *URLStore) GetUserQuota(ctx context.Context, userID string) (quota models.Quota, err error) {
+	ctx, op := u.begin(ctx, "GetUserQuota")
+	defer op.end(&err)
+	quota = u.Quota
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, GetUserQuota)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("GetUserQuota get connection failure")
+			return quota, err
+		}
+		defer conn.Close()
+
+		var maxLive, maxDaily sql.NullInt64
+		err = conn.QueryRowContext(ctx, sqlRequest, userID).Scan(&maxLive, &maxDaily)
+		if errors.Is(err, sql.ErrNoRows) {
+			return quota, nil
+		}
+		if err != nil {
+			return quota, err
+		}
+		if maxLive.Valid {
+			quota.MaxLiveLinks = int(maxLive.Int64)
+		}
+		if maxDaily.Valid {
+			quota.MaxDailyLinks = int(maxDaily.Int64)
+		}
+		return quota, nil
+	}
+
+	u.Mu.RLock()
+	override := u.EmulateQuotas[userID]
+	u.Mu.RUnlock()
+	return override.Apply(quota), nil
+}
+
+// SetUserQuota save overrides of user, nil fields fall back to global quota
+func (u *URLStore) SetUserQuota(ctx context.Context, userID string, override models.QuotaOverride) (err error) {
+	ctx, op := u.begin(ctx, "SetUserQuota")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, SetUserQuota)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("SetUserQuota get connection failure")
+			return err
+		}
+		defer conn.Close()
+
+		_, err = conn.ExecContext(ctx, sqlRequest, userID, override.MaxLiveLinks, override.MaxDailyLinks)
+		return err
+	}
+
+	u.Mu.Lock()
+	u.EmulateQuotas[userID] = override
+	u.Mu.Unlock()
+	return u.storeRecord(ctx, fileRecord{Kind: fileKindQuota, UserID: userID, Quota: &override})
+}
+
+// GetQuotaUsage count live links of user and links created today
+func (u *URLStore) GetQuotaUsage(ctx context.Context, userID string) (usage models.QuotaUsage, err error) {
+	ctx, op := u.begin(ctx, "GetQuotaUsage")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("GetQuotaUsage get connection failure")
+			return usage, err
+		}
+		defer conn.Close()
+		return u.quotaUsage(ctx, conn, userID)
+	}
+
+	dayStart := QuotaDayStart(time.Now())
+	u.Mu.RLock()
+	for key, r := range u.EmulateDB {
+		// every redirect is stored twice: by short link and by url
+		if key != r.Redirect || r.User != userID {
+			continue
+		}
+		if r.IsDelete == 0 && !r.Expired() {
+			usage.LiveLinks++
+		}
+		if !r.Created().Before(dayStart) {
+			usage.DailyLinks++
+		}
+	}
+	u.Mu.RUnlock()
+	return usage, nil
+}
+
+// rowQuerier is connection or transaction
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// quotaUsage count usage in db, start of day is computed by database, see GetQuotaUsage query
+func (u *URLStore) quotaUsage(ctx context.Context, q rowQuerier, userID string) (usage models.QuotaUsage, err error) {
+	sqlRequest, ctx, cancel := Get(ctx, GetQuotaUsage)
+	defer cancel()
+
+	err = q.QueryRowContext(ctx, sqlRequest, userID).Scan(&usage.LiveLinks, &usage.DailyLinks)
+	return usage, err
+}
+
+// QuotaDayStart return start of UTC day, daily quota is counted from
+func QuotaDayStart(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
@@ -3,18 +3,42 @@ package stores
 
 import (
 	"bufio"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Aligator77/go_practice/internal/config"
+	"github.com/Aligator77/go_practice/internal/helpers"
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/metrics"
 	"github.com/Aligator77/go_practice/internal/models"
+	"github.com/Aligator77/go_practice/internal/policy"
+	"github.com/Aligator77/go_practice/internal/tracing"
 )
 
+var (
+	ErrRedirectNotFound = errors.New("redirect not found")
+	ErrRedirectGone     = errors.New("redirect is deleted or expired")
+	ErrInvalidURL       = errors.New("invalid url")
+	// ErrSlugTaken is returned by NewRedirect, when short link belongs to another redirect
+	ErrSlugTaken = errors.New("short link is already used")
+)
+
+// uniqueViolation is postgres error code of unique index violation
+const uniqueViolation = "23505"
+
 type URLStore struct {
 	DB         *config.ConnectionPool
 	BaseURL    string
@@ -23,6 +47,28 @@ type URLStore struct {
 	DisableDB  string
 	EmulateDB  map[string]models.Redirect
 	Mu         sync.RWMutex
+	Canonical  helpers.CanonicalOptions
+
+	// EmulateAPIKeys keep api keys by hash when db is disabled, changes are written to file store
+	EmulateAPIKeys map[string]models.APIKey
+	// EmulateBlockedUsers and EmulateAudit keep admin data when db is disabled, it is written to file store too
+	EmulateBlockedUsers map[string]models.BlockedUser
+	EmulateAudit        []models.AuditRecord
+
+	// Quota is global quota of users, EmulateQuotas keep overrides when db is disabled and file store
+	Quota         models.Quota
+	EmulateQuotas map[string]models.QuotaOverride
+	quotaLocks    [quotaLockStripes]sync.Mutex
+
+	// background track deletes, which run after response is sent,
+	// deleteStarts keep start time of every delete in progress by its number
+	background   sync.WaitGroup
+	deletesMu    sync.Mutex
+	deleteStarts map[int64]time.Time
+	deleteSeq    int64
+
+	// destPolicy is destination policy, it is swapped on config reload. Nil disables checks
+	destPolicy atomic.Pointer[policy.Policy]
 }
 
 func NewURLService(db *config.ConnectionPool, Logger zerolog.Logger, BaseURL string, localStore string, DisableDBStore string) (us *URLStore) {
@@ -34,11 +80,56 @@ func NewURLService(db *config.ConnectionPool, Logger zerolog.Logger, BaseURL str
 		DisableDB:  DisableDBStore,
 		EmulateDB:  make(map[string]models.Redirect, 0),
 		Mu:         sync.RWMutex{},
+		Canonical:  helpers.CanonicalOptions{SortQuery: true},
+
+		EmulateAPIKeys:      make(map[string]models.APIKey),
+		EmulateBlockedUsers: make(map[string]models.BlockedUser),
+		EmulateQuotas:       make(map[string]models.QuotaOverride),
+
+		deleteStarts: make(map[int64]time.Time),
 	}
+	defaultPolicy, _ := policy.New(policy.Config{BaseURL: BaseURL, Shorteners: policy.DefaultShorteners})
+	us.SetPolicy(defaultPolicy)
 	us.RestoreFromFile()
 	return us
 }
 
+// ValidateDestination check link is valid url and passes destination policy,
+// policy errors are returned as is, so caller can tell them apart
+func (u *URLStore) ValidateDestination(ctx context.Context, link string) error {
+	validateURL, err := helpers.ValidateURL(link)
+	if err != nil {
+		return err
+	}
+	if !validateURL {
+		return ErrInvalidURL
+	}
+	p := u.Policy()
+	if p == nil {
+		return nil
+	}
+	return p.Check(ctx, u.CanonicalURL(link))
+}
+
+// SetPolicy replace destination policy, requests in progress finish with old one
+func (u *URLStore) SetPolicy(p *policy.Policy) {
+	u.destPolicy.Store(p)
+}
+
+// Policy return current destination policy
+func (u *URLStore) Policy() *policy.Policy {
+	return u.destPolicy.Load()
+}
+
+// CanonicalURL return canonical form of link, link is returned as is when it can not be parsed
+func (u *URLStore) CanonicalURL(link string) string {
+	canonical, err := helpers.CanonicalizeURL(link, u.Canonical)
+	if err != nil {
+		return link
+	}
+	return canonical
+}
+
 func (u *URLStore) Shutdown() error {
 	err := u.DB.Close()
 
@@ -55,23 +146,25 @@ func (u *URLStore) MakeFullURL(link string) string {
 	}
 }
 
-func (u *URLStore) StoreToFile(link string) error {
+func (u *URLStore) StoreToFile(ctx context.Context, link string) (err error) {
+	ctx, op := u.begin(ctx, "StoreToFile")
+	defer op.end(&err)
 	if len(u.LocalStore) > 0 {
 		f, err := os.OpenFile(u.LocalStore, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
 		if err != nil {
-			u.Logger.Error().Err(err).Msg("Cannot open localStoreFile")
+			logging.FromContext(ctx).Error().Err(err).Msg("Cannot open localStoreFile")
 			return err
 		}
 
 		defer func(f *os.File) {
 			err := f.Close()
 			if err != nil {
-				u.Logger.Error().Err(err).Msg("Cannot close localStoreFile")
+				logging.FromContext(ctx).Error().Err(err).Msg("Cannot close localStoreFile")
 			}
 		}(f)
 
 		if _, err = f.WriteString(link); err != nil {
-			u.Logger.Error().Err(err).Msg("Cannot write to localStoreFile")
+			logging.FromContext(ctx).Error().Err(err).Msg("Cannot write to localStoreFile")
 			return err
 		}
 	}
@@ -93,9 +186,15 @@ func (u *URLStore) RestoreFromFile() {
 			}
 		}(f)
 		var redirects []models.Redirect
+		var records []fileRecord
 		scan := bufio.NewScanner(f)
 		for scan.Scan() {
 			line := scan.Bytes()
+			var record fileRecord
+			if err := json.Unmarshal(line, &record); err == nil && len(record.Kind) > 0 {
+				records = append(records, record)
+				continue
+			}
 			var redirect models.Redirect
 			err = json.Unmarshal(line, &redirect)
 			if err != nil {
@@ -108,43 +207,57 @@ func (u *URLStore) RestoreFromFile() {
 		}
 		u.Mu.Lock()
 		for _, redirect := range redirects {
+			// later lines of file contain updates, old url must not point to redirect anymore
+			if len(redirect.CanonicalURL) == 0 {
+				redirect.CanonicalURL = u.CanonicalURL(redirect.URL)
+			}
+			if old, ok := u.EmulateDB[redirect.Redirect]; ok && old.URLKey() != redirect.URLKey() && u.EmulateDB[old.URLKey()].Redirect == redirect.Redirect {
+				delete(u.EmulateDB, old.URLKey())
+			}
 			u.EmulateDB[redirect.Redirect] = redirect
-			u.EmulateDB[redirect.URL] = redirect
+			u.EmulateDB[redirect.URLKey()] = redirect
+		}
+		for _, record := range records {
+			u.restoreRecord(record)
 		}
 		u.Mu.Unlock()
 
 	}
 }
 
-func (u *URLStore) GetRedirect(id string) (redirect models.Redirect, err error) {
+func (u *URLStore) GetRedirect(ctx context.Context, id string) (redirect models.Redirect, err error) {
+	ctx, op := u.begin(ctx, "GetRedirect")
+	defer op.end(&err)
 	if u.DisableDB == "0" {
-		sqlRequest, ctx, cancel := Get(GetRedirect)
+		sqlRequest, ctx, cancel := Get(ctx, GetRedirect)
 		defer cancel()
 
 		conn, err := u.DB.Conn(ctx)
 		if err != nil {
-			u.Logger.Error().Err(err).Msg("GetRedirect get connection failure")
+			logging.FromContext(ctx).Error().Err(err).Msg("GetRedirect get connection failure")
 			return redirect, err
 		}
 		defer conn.Close()
 
 		row, err := conn.QueryContext(ctx, sqlRequest, id)
 		if err != nil {
-			u.Logger.Error().Err(err).Str("data", id).Msg("GetRedirect exec failure")
+			logging.FromContext(ctx).Error().Err(err).Str("data", id).Msg("GetRedirect exec failure")
 			return redirect, err
 		}
 
 		for row.Next() {
 
 			if err := row.Scan(
+				&redirect.ID,
 				&redirect.URL,
 				&redirect.Redirect,
 				&redirect.DateCreate,
 				&redirect.DateUpdate,
 				&redirect.IsDelete, // change for iter15
 				&redirect.User,
+				&redirect.DateExpire,
 			); err != nil {
-				u.Logger.Error().Err(err).Msg("scan failure")
+				logging.FromContext(ctx).Error().Err(err).Msg("scan failure")
 				return redirect, err
 			}
 		}
@@ -161,21 +274,25 @@ func (u *URLStore) GetRedirect(id string) (redirect models.Redirect, err error)
 	return redirect, nil
 }
 
-func (u *URLStore) GetRedirectByURL(url string) (redirect models.Redirect, err error) {
+// GetRedirectByURL search not deleted and not expired redirect by canonical form of url
+func (u *URLStore) GetRedirectByURL(ctx context.Context, url string) (redirect models.Redirect, err error) {
+	ctx, op := u.begin(ctx, "GetRedirectByURL")
+	defer op.end(&err)
+	url = u.CanonicalURL(url)
 	if u.DisableDB == "0" {
-		sqlRequest, ctx, cancel := Get(GetRedirectByURL)
+		sqlRequest, ctx, cancel := Get(ctx, GetRedirectByURL)
 		defer cancel()
 
 		conn, err := u.DB.Conn(ctx)
 		if err != nil {
-			u.Logger.Error().Err(err).Msg("GetRedirect get connection failure")
+			logging.FromContext(ctx).Error().Err(err).Msg("GetRedirect get connection failure")
 			return redirect, err
 		}
 		defer conn.Close()
 
 		row, err := conn.QueryContext(ctx, sqlRequest, url)
 		if err != nil {
-			u.Logger.Error().Err(err).Str("data", url).Msg("GetRedirect exec failure")
+			logging.FromContext(ctx).Error().Err(err).Str("data", url).Msg("GetRedirect exec failure")
 			return redirect, err
 		}
 
@@ -190,7 +307,7 @@ func (u *URLStore) GetRedirectByURL(url string) (redirect models.Redirect, err e
 				&redirect.IsDelete, // change for iter15
 				&redirect.User,
 			); err != nil {
-				u.Logger.Error().Err(err).Msg("scan failure")
+				logging.FromContext(ctx).Error().Err(err).Msg("scan failure")
 				return redirect, err
 			}
 		}
@@ -202,65 +319,96 @@ func (u *URLStore) GetRedirectByURL(url string) (redirect models.Redirect, err e
 		u.Mu.RLock()
 		redirect = u.EmulateDB[url]
 		u.Mu.RUnlock()
+		// dead link is not duplicate, the same as in db query
+		if redirect.IsDelete != 0 || redirect.Expired() {
+			redirect = models.Redirect{}
+		}
 	}
 
 	return redirect, nil
 }
 
-func (u *URLStore) NewRedirect(redirect models.Redirect) (res models.Redirect, err error) {
+func (u *URLStore) NewRedirect(ctx context.Context, redirect models.Redirect) (res models.Redirect, err error) {
+	ctx, op := u.begin(ctx, "NewRedirect")
+	defer op.end(&err)
+	if len(redirect.CanonicalURL) == 0 {
+		redirect.CanonicalURL = u.CanonicalURL(redirect.URL)
+	}
 
 	if u.DisableDB == "0" {
-		sqlRequest, ctx, cancel := Get(InsertRedirect)
+		sqlRequest, ctx, cancel := Get(ctx, InsertRedirect)
 		defer cancel()
 
 		conn, err := u.DB.Conn(ctx)
 		if err != nil {
-			u.Logger.Error().Err(err).Msg("NewRedirect get connection failure")
+			logging.FromContext(ctx).Error().Err(err).Msg("NewRedirect get connection failure")
 			return redirect, err
 		}
 		defer conn.Close()
 
-		res, err := conn.ExecContext(ctx, sqlRequest, redirect.ID, redirect.IsDelete, redirect.URL, redirect.Redirect, redirect.User) // change for iter15
+		var dateExpire sql.NullString
+		if len(redirect.DateExpire) > 0 {
+			dateExpire = sql.NullString{String: redirect.DateExpire, Valid: true}
+		}
+		res, err := conn.ExecContext(ctx, sqlRequest, redirect.ID, redirect.IsDelete, redirect.URL, redirect.Redirect, redirect.User, dateExpire, redirect.CanonicalURL) // change for iter15
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == "redirects_redirect_unique_index" {
+			return redirect, ErrSlugTaken
+		}
 		if err != nil {
-			u.Logger.Error().Err(err).Str("data", redirect.String()).Msg("NewRedirect get connection failure")
+			logging.FromContext(ctx).Error().Err(err).Str("data", redirect.String()).Msg("NewRedirect get connection failure")
 			return redirect, err
 		}
 
 		if affected, err := res.RowsAffected(); affected > 0 {
-			u.Logger.Warn().Str("affected", strconv.FormatInt(affected, 10)).Msg("NewRedirect exec has affected rows")
+			logging.FromContext(ctx).Warn().Str("affected", strconv.FormatInt(affected, 10)).Msg("NewRedirect exec has affected rows")
 		} else if err != nil {
-			u.Logger.Error().Err(err).Str("data", redirect.String()).Msg("NewRedirect get connection failure")
+			logging.FromContext(ctx).Error().Err(err).Str("data", redirect.String()).Msg("NewRedirect get connection failure")
 		}
 
 	} else {
 		u.Mu.Lock()
+		if existing, ok := u.EmulateDB[redirect.Redirect]; ok && existing.Redirect == redirect.Redirect {
+			u.Mu.Unlock()
+			return redirect, ErrSlugTaken
+		}
 		u.EmulateDB[redirect.Redirect] = redirect
-		u.EmulateDB[redirect.URL] = redirect
+		u.EmulateDB[redirect.URLKey()] = redirect
 		u.Mu.Unlock()
 	}
 
 	dataFile, _ := json.Marshal(redirect)
-	_ = u.StoreToFile(string(dataFile) + "\n")
+	_ = u.StoreToFile(ctx, string(dataFile)+"\n")
 
 	return redirect, nil
 }
 
-func (u *URLStore) NewRedirectsBatch(redirects []*models.Redirect) (id int64, err error) {
+func (u *URLStore) NewRedirectsBatch(ctx context.Context, redirects []*models.Redirect) (id int64, err error) {
+	ctx, op := u.begin(ctx, "NewRedirectsBatch")
+	defer op.end(&err)
 	if len(redirects) == 0 {
 		return 0, nil
 	}
 
+	for _, r := range redirects {
+		if len(r.CanonicalURL) == 0 {
+			r.CanonicalURL = u.CanonicalURL(r.URL)
+		}
+	}
+
 	if u.DisableDB == "0" {
-		sqlRequest, ctx, cancel := Get(InsertBatchRedirects)
+		sqlRequest, ctx, cancel := Get(ctx, InsertBatchRedirects)
 		defer cancel()
 
 		var queryStr strings.Builder
 		queryStr.WriteString(sqlRequest)
 
+		// values are passed as params, urls may contain quotes
+		args := make([]any, 0, len(redirects)*6)
 		for i, r := range redirects {
-			queryStr.WriteString(" (")
-			queryStr.WriteString(`'` + r.ID + `', B'` + strconv.Itoa(r.IsDelete) + `', '` + r.URL + `', '` + r.Redirect + `', NOW(), NOW(), '` + r.User + `'`) // change for iter15
-			queryStr.WriteString(")")
+			n := len(args)
+			queryStr.WriteString(" ($" + strconv.Itoa(n+1) + ", $" + strconv.Itoa(n+2) + ", $" + strconv.Itoa(n+3) + ", $" + strconv.Itoa(n+4) + ", NOW(), NOW(), $" + strconv.Itoa(n+5) + ", $" + strconv.Itoa(n+6) + ")")
+			args = append(args, r.ID, strconv.Itoa(r.IsDelete), r.URL, r.Redirect, r.User, r.CanonicalURL) // change for iter15
 			if i != len(redirects)-1 {
 				queryStr.WriteString(",")
 			}
@@ -268,95 +416,194 @@ func (u *URLStore) NewRedirectsBatch(redirects []*models.Redirect) (id int64, er
 
 		conn, err := u.DB.Conn(ctx)
 		if err != nil {
-			u.Logger.Error().Err(err).Msg("NewRedirectsBatch get connection failure")
+			logging.FromContext(ctx).Error().Err(err).Msg("NewRedirectsBatch get connection failure")
 			return id, err
 		}
 		defer conn.Close()
-		res, err := conn.ExecContext(ctx, queryStr.String())
+		res, err := conn.ExecContext(ctx, queryStr.String(), args...)
 		if err != nil {
-			u.Logger.Error().Err(err).Str("data", strconv.FormatInt(id, 10)).Msg("NewRedirectsBatch ExecContext failure")
+			logging.FromContext(ctx).Error().Err(err).Str("data", strconv.FormatInt(id, 10)).Msg("NewRedirectsBatch ExecContext failure")
 			return id, err
 		}
 
 		if affected, err := res.RowsAffected(); affected > 0 {
-			u.Logger.Warn().Str("affected", strconv.FormatInt(affected, 10)).Msg("NewRedirectsBatch exec has affected rows")
+			logging.FromContext(ctx).Warn().Str("affected", strconv.FormatInt(affected, 10)).Msg("NewRedirectsBatch exec has affected rows")
 		} else if err != nil {
-			u.Logger.Error().Err(err).Str("data", strconv.FormatInt(id, 10)).Msg("NewRedirectsBatch RowsAffected = 0")
+			logging.FromContext(ctx).Error().Err(err).Str("data", strconv.FormatInt(id, 10)).Msg("NewRedirectsBatch RowsAffected = 0")
 		}
 	}
 	u.Mu.Lock()
 	for _, r := range redirects {
 		u.EmulateDB[r.Redirect] = *r
-		u.EmulateDB[r.URL] = *r
+		u.EmulateDB[r.URLKey()] = *r
 		dataFile, _ := json.Marshal(r)
-		_ = u.StoreToFile(string(dataFile) + "\n")
+		_ = u.StoreToFile(ctx, string(dataFile)+"\n")
 	}
 	u.Mu.Unlock()
 
 	return id, nil
 }
 
-func (u *URLStore) DeleteRedirect(redirects []string) (affected bool, err error) {
-	sqlRequest, ctx, cancel := Get(DisableRedirects)
-	defer cancel()
+// DeleteRedirect mark redirects of user as deleted, redirects of other users are skipped
+func (u *URLStore) DeleteRedirect(ctx context.Context, userID string, redirects []string) (affected bool, err error) {
+	ctx, op := u.begin(ctx, "DeleteRedirect")
+	defer op.end(&err)
 
-	var queryStr strings.Builder
-	queryStr.WriteString(sqlRequest)
-	queryStr.WriteString("where redirect in (")
+	var deleted []models.Redirect
 	u.Mu.Lock()
-	for i, r := range redirects {
-		queryStr.WriteString(`'` + r + `'`)
-		if i != len(redirects)-1 {
-			queryStr.WriteString(",")
-		}
-		if redirect, ok := u.EmulateDB[r]; ok {
+	for _, r := range redirects {
+		if redirect, ok := u.EmulateDB[r]; ok && redirect.Redirect == r && redirect.User == userID {
 			redirect.IsDelete = 1 // change for iter15
 			u.EmulateDB[r] = redirect
+			if u.EmulateDB[redirect.URLKey()].Redirect == r {
+				u.EmulateDB[redirect.URLKey()] = redirect
+			}
+			deleted = append(deleted, redirect)
 		}
 	}
 	u.Mu.Unlock()
 
-	queryStr.WriteString(")")
-	u.Logger.Warn().Msg("DisableRedirects query " + queryStr.String())
+	if u.DisableDB != "0" {
+		// in db mode file is not read, so it is written only without db
+		for _, redirect := range deleted {
+			dataFile, _ := json.Marshal(redirect)
+			_ = u.StoreToFile(ctx, string(dataFile)+"\n")
+		}
+		return len(deleted) > 0, nil
+	}
+
+	sqlRequest, ctx, cancel := Get(ctx, DisableRedirects)
+	defer cancel()
 
 	conn, err := u.DB.Conn(ctx)
 	if err != nil {
-		u.Logger.Error().Err(err).Msg("DisableRedirects get connection failure")
+		logging.FromContext(ctx).Error().Err(err).Msg("DisableRedirects get connection failure")
 		return false, err
 	}
 	defer conn.Close()
-	res, err := conn.ExecContext(ctx, queryStr.String())
+	res, err := conn.ExecContext(ctx, sqlRequest, pq.Array(redirects), userID)
 	if err != nil {
-		u.Logger.Error().Err(err).Str("data", queryStr.String()).Msg("DisableRedirects get connection failure")
+		logging.FromContext(ctx).Error().Err(err).Strs("data", redirects).Msg("DisableRedirects ExecContext failure")
 		return false, err
 	}
 	a, err := res.RowsAffected()
 	if a > 0 {
-		u.Logger.Warn().Str("affected", strconv.FormatInt(a, 10)).Msg("DisableRedirects exec has affected rows")
+		logging.FromContext(ctx).Warn().Str("affected", strconv.FormatInt(a, 10)).Msg("DisableRedirects exec has affected rows")
 	} else if err != nil {
-		u.Logger.Error().Err(err).Str("affected", strconv.FormatInt(a, 10)).Msg("DisableRedirects RowsAffected = 0")
+		logging.FromContext(ctx).Error().Err(err).Str("affected", strconv.FormatInt(a, 10)).Msg("DisableRedirects RowsAffected = 0")
+	}
+
+	return a > 0, nil
+}
+
+// DeleteRedirectAsync run DeleteRedirect in background, WaitBackground wait for it on shutdown.
+// Delete keeps trace of ctx, but it is not canceled with ctx
+func (u *URLStore) DeleteRedirectAsync(ctx context.Context, userID string, redirects []string) {
+	ctx = context.WithoutCancel(ctx)
+	u.background.Add(1)
+	u.deletesMu.Lock()
+	u.deleteSeq++
+	id := u.deleteSeq
+	u.deleteStarts[id] = time.Now()
+	u.deletesMu.Unlock()
+	go func() {
+		defer u.background.Done()
+		defer func() {
+			u.deletesMu.Lock()
+			delete(u.deleteStarts, id)
+			u.deletesMu.Unlock()
+		}()
+		_, _ = u.DeleteRedirect(ctx, userID, redirects)
+	}()
+}
+
+// PendingDeletes return number of background deletes in progress
+func (u *URLStore) PendingDeletes() int64 {
+	u.deletesMu.Lock()
+	defer u.deletesMu.Unlock()
+	return int64(len(u.deleteStarts))
+}
+
+// OldestDelete return how long the oldest background delete is running, zero when there are none.
+// Delete running too long means background work is stuck
+func (u *URLStore) OldestDelete() time.Duration {
+	u.deletesMu.Lock()
+	defer u.deletesMu.Unlock()
+	var oldest time.Duration
+	for _, start := range u.deleteStarts {
+		if age := time.Since(start); age > oldest {
+			oldest = age
+		}
 	}
+	return oldest
+}
+
+// WaitBackground wait for background deletes, ctx error is returned when they are not done in time
+func (u *URLStore) WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		u.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush write file store from os cache to disk
+func (u *URLStore) Flush() error {
+	if len(u.LocalStore) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(u.LocalStore, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
 
-	return true, nil
+func (u *URLStore) GetRedirectsByUser(ctx context.Context, userID string) (redirects []models.Redirect, err error) {
+	ctx, op := u.begin(ctx, "GetRedirectsByUser")
+	defer op.end(&err)
+	err = u.eachRedirectByUser(ctx, GetRedirectsByUser, userID, func(redirect models.Redirect) error {
+		redirects = append(redirects, redirect)
+		return nil
+	})
+
+	return redirects, err
+}
+
+// EachRedirectByUser call fn for every users redirect, in db mode rows are read one by one
+// without loading all of them to memory. Iteration stops on first error of fn.
+// It is made for export, so query has longer timeout than other queries
+func (u *URLStore) EachRedirectByUser(ctx context.Context, userID string, fn func(models.Redirect) error) (err error) {
+	ctx, op := u.begin(ctx, "EachRedirectByUser")
+	defer op.end(&err)
+	return u.eachRedirectByUser(ctx, ExportRedirectsByUser, userID, fn)
 }
 
-func (u *URLStore) GetRedirectsByUser(userID string) (redirects []models.Redirect, err error) {
+func (u *URLStore) eachRedirectByUser(ctx context.Context, query int, userID string, fn func(models.Redirect) error) error {
 	if u.DisableDB == "0" {
 
-		sqlRequest, ctx, cancel := Get(GetRedirectsByUser)
+		sqlRequest, ctx, cancel := Get(ctx, query)
 		defer cancel()
 
 		conn, err := u.DB.Conn(ctx)
 		if err != nil {
-			u.Logger.Error().Err(err).Msg("NewRedirect get connection failure")
-			return redirects, err
+			logging.FromContext(ctx).Error().Err(err).Msg("NewRedirect get connection failure")
+			return err
 		}
 		defer conn.Close()
 		row, err := conn.QueryContext(ctx, sqlRequest, userID)
 		if err != nil {
-			u.Logger.Error().Err(err).Str("userID", userID).Msg("GetRedirect exec failure")
-			return redirects, err
+			logging.FromContext(ctx).Error().Err(err).Str("userID", userID).Msg("GetRedirect exec failure")
+			return err
 		}
+		defer row.Close()
 
 		for row.Next() {
 			var redirect models.Redirect
@@ -369,24 +616,135 @@ func (u *URLStore) GetRedirectsByUser(userID string) (redirects []models.Redirec
 				&redirect.IsDelete, // change for iter15
 				&redirect.User,
 			); err != nil {
-				u.Logger.Error().Err(err).Msg("scan failure")
-				return redirects, err
+				logging.FromContext(ctx).Error().Err(err).Msg("scan failure")
+				return err
+			}
+			if err := fn(redirect); err != nil {
+				return err
 			}
-			redirects = append(redirects, redirect)
 		}
 		if err = row.Err(); err != nil {
-			return redirects, err
+			return err
 		}
 	} else {
+		var redirects []models.Redirect
 		u.Mu.RLock()
 
-		for _, r := range u.EmulateDB {
-			if r.User == userID {
+		for key, r := range u.EmulateDB {
+			// every redirect is stored twice: by short link and by url
+			if key == r.Redirect && r.User == userID {
 				redirects = append(redirects, r)
 			}
 		}
 		u.Mu.RUnlock()
+
+		// fn may be slow, e.g. write to network, so it is called without lock
+		for _, r := range redirects {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// UpdateRedirect change destination url of users redirect, it returns ErrRedirectNotFound
+// when redirect not exist or belongs to another user and ErrRedirectGone when it is deleted or expired
+func (u *URLStore) UpdateRedirect(ctx context.Context, slug string, newURL string, userID string) (redirect models.Redirect, err error) {
+	ctx, op := u.begin(ctx, "UpdateRedirect")
+	defer op.end(&err)
+	if u.DisableDB == "0" {
+		sqlRequest, ctx, cancel := Get(ctx, UpdateRedirect)
+		defer cancel()
+
+		conn, err := u.DB.Conn(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("UpdateRedirect get connection failure")
+			return redirect, err
+		}
+		defer conn.Close()
+
+		res, err := conn.ExecContext(ctx, sqlRequest, newURL, slug, userID, u.CanonicalURL(newURL))
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("data", slug).Msg("UpdateRedirect exec failure")
+			return redirect, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			logging.FromContext(ctx).Error().Err(err).Str("data", slug).Msg("UpdateRedirect RowsAffected failure")
+			return redirect, err
+		}
+		if affected == 0 {
+			// link is missing or it is deleted or expired after check of handler
+			current, err := u.GetRedirect(ctx, slug)
+			if err == nil && current.Redirect == slug && current.User == userID {
+				return redirect, ErrRedirectGone
+			}
+			return redirect, ErrRedirectNotFound
+		}
+
+		redirect, err = u.GetRedirect(ctx, slug)
+		if err != nil {
+			return redirect, err
+		}
+	}
+
+	// memory store is used as cache in db mode too, so it must be updated in both modes
+	u.Mu.Lock()
+	cached, ok := u.EmulateDB[slug]
+	if u.DisableDB != "0" {
+		if !ok || cached.Redirect != slug || cached.User != userID {
+			u.Mu.Unlock()
+			return redirect, ErrRedirectNotFound
+		}
+		if cached.IsDelete == 1 || cached.Expired() {
+			u.Mu.Unlock()
+			return redirect, ErrRedirectGone
+		}
+		redirect = cached
+		redirect.URL = newURL
+		redirect.DateUpdate = time.Now().String()
+	}
+	redirect.CanonicalURL = u.CanonicalURL(newURL)
+	if ok {
+		if u.EmulateDB[cached.URLKey()].Redirect == slug {
+			delete(u.EmulateDB, cached.URLKey())
+		}
+		u.EmulateDB[redirect.Redirect] = redirect
+		u.EmulateDB[redirect.URLKey()] = redirect
 	}
+	u.Mu.Unlock()
+
+	dataFile, _ := json.Marshal(redirect)
+	_ = u.StoreToFile(ctx, string(dataFile)+"\n")
 
-	return redirects, nil
+	return redirect, nil
+}
+
+// operation is store method in progress, it is traced and measured
+type operation struct {
+	method  string
+	backend string
+	start   time.Time
+	span    trace.Span
+}
+
+// begin start span of store method, end of operation must be called with defer
+func (u *URLStore) begin(ctx context.Context, method string) (context.Context, *operation) {
+	ctx, span := tracing.Start(ctx, "URLStore."+method, trace.WithAttributes(attribute.String("store.backend", u.backend())))
+	return ctx, &operation{method: method, backend: u.backend(), start: time.Now(), span: span}
+}
+
+// end record duration and error of operation
+func (op *operation) end(err *error) {
+	metrics.ObserveStore(op.method, op.backend, op.start, *err)
+	tracing.End(op.span, *err)
+}
+
+func (u *URLStore) backend() string {
+	if u.DisableDB == "0" {
+		return "db"
+	}
+	return "memory"
 }
@@ -0,0 +1,223 @@
+// Package stores contain queries and function to use them
+package stores
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Aligator77/go_practice/internal/logging"
+	"github.com/Aligator77/go_practice/internal/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// listCursor point to last redirect of previous page
+type listCursor struct {
+	Date time.Time `json:"d"`
+	ID   string    `json:"id"`
+}
+
+func encodeCursor(r models.Redirect) string {
+	data, _ := json.Marshal(listCursor{Date: r.Created(), ID: r.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (c listCursor, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(data, &c); err != nil || len(c.ID) == 0 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// GetRedirectsByUserPage return one page of users redirects and cursor for next page,
+// cursor is empty on the last page
+func (u *URLStore) GetRedirectsByUserPage(ctx context.Context, userID string, filter models.URLListFilter) (redirects []models.Redirect, next string, err error) {
+	ctx, op := u.begin(ctx, "GetRedirectsByUserPage")
+	defer op.end(&err)
+	if len(userID) == 0 {
+		return redirects, next, nil
+	}
+	return u.redirectsPage(ctx, userID, filter)
+}
+
+// SearchRedirects return one page of redirects of all users, it is used by admins
+func (u *URLStore) SearchRedirects(ctx context.Context, filter models.URLListFilter) (redirects []models.Redirect, next string, err error) {
+	ctx, op := u.begin(ctx, "SearchRedirects")
+	defer op.end(&err)
+	return u.redirectsPage(ctx, "", filter)
+}
+
+// redirectsPage return page of redirects, empty userID means all users
+func (u *URLStore) redirectsPage(ctx context.Context, userID string, filter models.URLListFilter) (redirects []models.Redirect, next string, err error) {
+	var cursor listCursor
+	if len(filter.Cursor) > 0 {
+		cursor, err = decodeCursor(filter.Cursor)
+		if err != nil {
+			return redirects, next, err
+		}
+	}
+
+	if u.DisableDB == "0" {
+		redirects, err = u.getRedirectsByUserPageDB(ctx, userID, filter, cursor)
+		if err != nil {
+			return redirects, next, err
+		}
+	} else {
+		redirects = u.getRedirectsByUserPageMemory(userID, filter, cursor)
+	}
+
+	// one extra row was requested to know about next page
+	if len(redirects) > filter.Limit {
+		redirects = redirects[:filter.Limit]
+		next = encodeCursor(redirects[len(redirects)-1])
+	}
+
+	return redirects, next, nil
+}
+
+func (u *URLStore) getRedirectsByUserPageDB(ctx context.Context, userID string, filter models.URLListFilter, cursor listCursor) (redirects []models.Redirect, err error) {
+	query := GetRedirectsByUserPage
+	args := []any{userID}
+	if len(userID) == 0 {
+		query, args = SearchRedirects, nil
+	}
+	sqlRequest, ctx, cancel := Get(ctx, query)
+	defer cancel()
+
+	var queryStr strings.Builder
+	queryStr.WriteString(sqlRequest)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	switch filter.Status {
+	case models.URLStatusLive:
+		queryStr.WriteString(" and is_deleted = B'0'")
+	case models.URLStatusDeleted:
+		queryStr.WriteString(" and is_deleted = B'1'")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		queryStr.WriteString(" and date_create >= " + arg(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		queryStr.WriteString(" and date_create < " + arg(filter.CreatedTo))
+	}
+	if len(filter.Query) > 0 {
+		queryStr.WriteString(" and url ilike " + arg("%"+escapeLike(filter.Query)+"%"))
+	}
+
+	order, compare := "asc", ">"
+	if filter.Sort == models.SortDesc {
+		order, compare = "desc", "<"
+	}
+	if len(cursor.ID) > 0 {
+		queryStr.WriteString(" and (date_create, id) " + compare + " (" + arg(cursor.Date) + ", " + arg(cursor.ID) + ")")
+	}
+	queryStr.WriteString(" order by date_create " + order + ", id " + order)
+	queryStr.WriteString(" limit " + arg(filter.Limit+1))
+
+	conn, err := u.DB.Conn(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Msg("GetRedirectsByUserPage get connection failure")
+		return redirects, err
+	}
+	defer conn.Close()
+
+	row, err := conn.QueryContext(ctx, queryStr.String(), args...)
+	if err != nil {
+		logging.FromContext(ctx).Error().Err(err).Str("userID", userID).Msg("GetRedirectsByUserPage exec failure")
+		return redirects, err
+	}
+	defer row.Close()
+
+	for row.Next() {
+		var redirect models.Redirect
+		if err := row.Scan(
+			&redirect.ID,
+			&redirect.URL,
+			&redirect.Redirect,
+			&redirect.DateCreate,
+			&redirect.DateUpdate,
+			&redirect.IsDelete,
+			&redirect.User,
+		); err != nil {
+			logging.FromContext(ctx).Error().Err(err).Msg("scan failure")
+			return redirects, err
+		}
+		redirects = append(redirects, redirect)
+	}
+
+	return redirects, row.Err()
+}
+
+func (u *URLStore) getRedirectsByUserPageMemory(userID string, filter models.URLListFilter, cursor listCursor) (redirects []models.Redirect) {
+	query := strings.ToLower(filter.Query)
+
+	u.Mu.RLock()
+	for key, r := range u.EmulateDB {
+		// every redirect is stored twice: by short link and by url
+		if key != r.Redirect || len(userID) > 0 && r.User != userID {
+			continue
+		}
+		if filter.Status == models.URLStatusLive && r.IsDelete == 1 ||
+			filter.Status == models.URLStatusDeleted && r.IsDelete == 0 {
+			continue
+		}
+		created := r.Created()
+		if !filter.CreatedFrom.IsZero() && created.Before(filter.CreatedFrom) ||
+			!filter.CreatedTo.IsZero() && !created.Before(filter.CreatedTo) {
+			continue
+		}
+		if len(query) > 0 && !strings.Contains(strings.ToLower(r.URL), query) {
+			continue
+		}
+		redirects = append(redirects, r)
+	}
+	u.Mu.RUnlock()
+
+	desc := filter.Sort == models.SortDesc
+	less := func(a models.Redirect, aDate time.Time, b models.Redirect, bDate time.Time) bool {
+		if !aDate.Equal(bDate) {
+			return aDate.Before(bDate)
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(redirects, func(i, j int) bool {
+		if desc {
+			return less(redirects[j], redirects[j].Created(), redirects[i], redirects[i].Created())
+		}
+		return less(redirects[i], redirects[i].Created(), redirects[j], redirects[j].Created())
+	})
+
+	if len(cursor.ID) > 0 {
+		cursorRedirect := models.Redirect{ID: cursor.ID}
+		start := sort.Search(len(redirects), func(i int) bool {
+			if desc {
+				return less(redirects[i], redirects[i].Created(), cursorRedirect, cursor.Date)
+			}
+			return less(cursorRedirect, cursor.Date, redirects[i], redirects[i].Created())
+		})
+		redirects = redirects[start:]
+	}
+	if len(redirects) > filter.Limit+1 {
+		redirects = redirects[:filter.Limit+1]
+	}
+
+	return redirects
+}
+
+// escapeLike escape wildcard symbols of like pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- short link must belong to one redirect, imported aliases are checked by this index, see stores.ErrSlugTaken
+create unique index if not exists redirects_redirect_unique_index
+    on public.redirects (redirect);
+
+DROP INDEX IF EXISTS public.redirects_redirect_index;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+create index if not exists redirects_redirect_index
+    on public.redirects (redirect);
+
+DROP INDEX IF EXISTS public.redirects_redirect_unique_index;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- failed and denied admin requests are written to audit too, records written before were successful
+alter table public.admin_audit
+    add column if not exists outcome text not null default 'success',
+    add column if not exists status  integer not null default 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table public.admin_audit
+    drop column if exists status,
+    drop column if exists outcome;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+create index if not exists redirects_user_id_date_create_index
+    on public.redirects (user_id, date_create, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.redirects_user_id_date_create_index;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table public.redirects
+    add column if not exists date_expire timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table public.redirects
+    drop column if exists date_expire;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table public.redirects
+    add column if not exists canonical_url text;
+
+-- canonical form is built by application, old rows get url as is here and
+-- go migration 8 (migrations/canonical.go) replaces it with canonical form
+update public.redirects
+set canonical_url = url
+where canonical_url is null;
+
+create index if not exists redirects_canonical_url_index
+    on public.redirects (canonical_url);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.redirects_canonical_url_index;
+alter table public.redirects
+    drop column if exists canonical_url;
+-- +goose StatementEnd
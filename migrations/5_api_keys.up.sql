@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists public.api_keys
+(
+    id          text primary key,
+    user_id     text      not null,
+    name        text      not null default '',
+    prefix      text      not null,
+    key_hash    text      not null,
+    scopes      text[]    not null,
+    date_create timestamp not null,
+    last_used   timestamp,
+    date_revoke timestamp
+);
+
+create unique index if not exists api_keys_key_hash_index
+    on public.api_keys (key_hash);
+
+create index if not exists api_keys_user_id_index
+    on public.api_keys (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.api_keys;
+-- +goose StatementEnd
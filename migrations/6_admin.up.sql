@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists public.blocked_users
+(
+    user_id     text primary key,
+    admin       text      not null,
+    reason      text      not null default '',
+    date_create timestamp not null
+);
+
+create table if not exists public.admin_audit
+(
+    id          text primary key,
+    admin       text      not null,
+    action      text      not null,
+    target      text      not null default '',
+    detail      text      not null default '',
+    date_create timestamp not null
+);
+
+create index if not exists admin_audit_date_create_index
+    on public.admin_audit (date_create);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.admin_audit;
+DROP TABLE IF EXISTS public.blocked_users;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists public.user_quotas
+(
+    user_id         text primary key,
+    max_live_links  integer,
+    max_daily_links integer
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS public.user_quotas;
+-- +goose StatementEnd
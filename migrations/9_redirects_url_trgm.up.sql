@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- substring search of user links (q filter, url ilike '%...%') can not use btree indexes,
+-- trigram index serves it. pg_trgm is trusted extension since postgres 13, owner of db can create it
+create extension if not exists pg_trgm;
+
+create index if not exists redirects_url_trgm_index
+    on public.redirects using gin (url gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS public.redirects_url_trgm_index;
+-- +goose StatementEnd
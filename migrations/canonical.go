@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+
+	"github.com/Aligator77/go_practice/internal/helpers"
+)
+
+// CanonicalBackfillVersion is version of CanonicalBackfill, sql migrations must not use it
+const CanonicalBackfillVersion = 8
+
+// canonicalBackfillPage is number of rows read at once
+const canonicalBackfillPage = 1000
+
+// CanonicalBackfill is go migration, it builds canonical_url of rows, which migration 4 filled with url as is.
+// Canonical form is made by the application canonicalizer, so old links are found as duplicates too
+func CanonicalBackfill(opts helpers.CanonicalOptions) *goose.Migration {
+	return goose.NewGoMigration(CanonicalBackfillVersion, &goose.GoFunc{
+		RunTx: func(ctx context.Context, tx *sql.Tx) error {
+			return backfillCanonical(ctx, tx, opts)
+		},
+	}, nil)
+}
+
+func backfillCanonical(ctx context.Context, tx *sql.Tx, opts helpers.CanonicalOptions) error {
+	lastID := ""
+	for {
+		rows, err := tx.QueryContext(ctx, `
+			select id, url
+			from public.redirects
+			where canonical_url = url and id > $1
+			order by id
+			limit $2
+		`, lastID, canonicalBackfillPage)
+		if err != nil {
+			return err
+		}
+		type row struct{ id, url string }
+		var page []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.url); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			page = append(page, r)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range page {
+			canonical, err := helpers.CanonicalizeURL(r.url, opts)
+			if err != nil || canonical == r.url {
+				// url which can not be parsed keeps itself as canonical form, the same as in URLStore.CanonicalURL
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `update public.redirects set canonical_url = $1 where id = $2`, canonical, r.id); err != nil {
+				return err
+			}
+		}
+		if len(page) < canonicalBackfillPage {
+			return nil
+		}
+		lastID = page[len(page)-1].id
+	}
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Aligator77/go_practice/internal/helpers"
+)
+
+func TestCanonicalBackfillRegistered(t *testing.T) {
+	// provider does not connect to db until migrations are run
+	db, err := sql.Open("postgres", "postgres://localhost/none")
+	require.NoError(t, err)
+	defer db.Close()
+
+	provider, err := goose.NewProvider("postgres", db, Embed,
+		goose.WithGoMigrations(CanonicalBackfill(helpers.CanonicalOptions{SortQuery: true})))
+	require.NoError(t, err, "Go миграция должна регистрироваться вместе с sql")
+	var backfill *goose.Source
+	for _, source := range provider.ListSources() {
+		if source.Version == CanonicalBackfillVersion {
+			assert.Nil(t, backfill, "Версия миграции должна быть уникальной")
+			backfill = source
+		}
+	}
+	require.NotNil(t, backfill)
+	assert.Equal(t, goose.TypeGo, backfill.Type)
+}